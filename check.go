@@ -0,0 +1,344 @@
+package mux
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/matthewmueller/enroute"
+	"github.com/matthewmueller/enroute/ast"
+)
+
+// ConflictKind describes how a route loses requests to other routes
+type ConflictKind string
+
+const (
+	// Shadowed routes lose some of their paths to a more specific route
+	Shadowed ConflictKind = "shadowed"
+	// Ambiguous routes match the same paths with the same priority, so the
+	// route that wins depends on the order they're stored in
+	Ambiguous ConflictKind = "ambiguous"
+	// Unreachable routes lose every path to other routes
+	Unreachable ConflictKind = "unreachable"
+)
+
+// Conflict between routes found by Check
+type Conflict struct {
+	Kind  ConflictKind
+	Route *Route // route that loses the path
+	By    *Route // route that matches the path instead, nil if none does
+	Path  string // example of a path the route loses
+}
+
+func (c *Conflict) String() string {
+	switch {
+	case c.Kind == Ambiguous:
+		return fmt.Sprintf("%s and %s both match %s, which goes to %s", c.Route, c.By, c.Path, c.By)
+	case c.Kind == Unreachable && c.By == nil:
+		return fmt.Sprintf("%s is unreachable, %s doesn't match any route", c.Route, c.Path)
+	case c.Kind == Unreachable:
+		return fmt.Sprintf("%s is unreachable, %s goes to %s", c.Route, c.Path, c.By)
+	default:
+		return fmt.Sprintf("%s is shadowed by %s for %s", c.Route, c.By, c.Path)
+	}
+}
+
+// Conflicts found by Check
+type Conflicts []*Conflict
+
+// Err returns an error listing the conflicts, or nil if there are none
+func (cs Conflicts) Err() error {
+	if len(cs) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "router: found %d route conflicts", len(cs))
+	for _, c := range cs {
+		b.WriteString("\n  " + c.String())
+	}
+	return fmt.Errorf("%s", b.String())
+}
+
+// Check the routes for paths that don't reach the route they look like they
+// should. It's meant to run in tests, e.g.
+//
+//	if err := router.Check().Err(); err != nil {
+//		t.Fatal(err)
+//	}
+//
+// Check matches example paths for every route using the router's priority
+// rules: static sections win over regexp slots, which win over slots, which
+// win over optional and wildcard slots. It reports routes that are shadowed by
+// a more specific route with slots (e.g. /{owner}/{repo} by /users/{id}),
+// routes that are ambiguous with a route of the same priority and routes that
+// are unreachable. Static routes that take a single path from a route with
+// slots, like /users/new from /users/{id}, are the usual way to special-case
+// a path and aren't reported. Routes are only checked against routes with the
+// same method and host.
+func (rt *Router) Check() (conflicts Conflicts) {
+	table := rt.registry.load()
+	for host, methods := range table.hosts.methods {
+		for method, tree := range methods {
+			conflicts = append(conflicts, tree.check(method, host)...)
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		a, b := conflicts[i].Route, conflicts[j].Route
+		if a.Method != b.Method {
+			return methodSort[a.Method] < methodSort[b.Method]
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		return conflicts[j].By != nil && (conflicts[i].By == nil || conflicts[i].By.Route < conflicts[j].By.Route)
+	})
+	return conflicts
+}
+
+// checked is a route being checked
+type checked struct {
+	route  *Route
+	key    string // value of the route in the tree
+	parsed *ast.Route
+	alone  *enroute.Tree // tree with only this route
+	static bool
+}
+
+// check the tree's routes
+func (t *tree) check(method, host string) (conflicts Conflicts) {
+	var routes []*checked
+	byKey := map[string]*checked{}
+	words := map[string]bool{}
+	t.Tree.Each(func(node *enroute.Node) bool {
+		key := node.Value
+		entries, ok := t.Entries[key]
+		if node.Label == "" || !ok || byKey[key] != nil {
+			// Routes with optional and wildcard slots have a node per path
+			return true
+		}
+		parsed, err := enroute.Parse(key)
+		if err != nil {
+			return true
+		}
+		alone := enroute.New()
+		if err := alone.Insert(key, key); err != nil {
+			return true
+		}
+		entry := entries[len(entries)-1]
+		c := &checked{
+			route: &Route{
+				Method:   method,
+				Host:     host,
+				Route:    entry.label(node.Label),
+				Name:     entry.name,
+				Matchers: entry.describe(),
+				Handler:  entry.handler,
+				Source:   entry.source,
+				route:    node.Label,
+				entry:    entry,
+			},
+			key:    key,
+			parsed: parsed,
+			alone:  alone,
+			static: !strings.Contains(key, "{"),
+		}
+		routes = append(routes, c)
+		byKey[key] = c
+		for _, section := range parsed.Sections {
+			if path, ok := section.(*ast.Path); ok {
+				for _, word := range strings.FieldsFunc(path.Value, notWord) {
+					words[strings.ToLower(word)] = true
+				}
+			}
+		}
+		return true
+	})
+	// Try the static words of other routes as slot values, which is how
+	// routes take paths from each other
+	values := make([]string, 0, len(words))
+	for word := range words {
+		values = append(values, word)
+	}
+	sort.Strings(values)
+	ambiguous := map[string]bool{}
+	for _, c := range routes {
+		lost := map[string]string{} // winning route => example path
+		var order []string
+		reached := false
+		for _, path := range examplesOf(c.parsed, values) {
+			// Only use paths that the route matches by itself
+			if _, err := c.alone.Match(path); err != nil {
+				continue
+			}
+			match, err := t.Tree.Match(path)
+			winner := ""
+			if err == nil {
+				winner = match.Value
+			}
+			if winner == c.key {
+				reached = true
+				continue
+			}
+			if _, ok := lost[winner]; !ok {
+				lost[winner] = path
+				order = append(order, winner)
+			}
+		}
+		if len(order) == 0 {
+			continue
+		}
+		if !reached {
+			conflict := &Conflict{Kind: Unreachable, Route: c.route, Path: lost[order[0]]}
+			if by := byKey[order[0]]; by != nil {
+				conflict.By = by.route
+			}
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+		for _, key := range order {
+			by := byKey[key]
+			if by == nil || by.static {
+				continue
+			}
+			kind := Shadowed
+			if tied(c.parsed, by.parsed) {
+				// Report each ambiguous pair once
+				pair := min(c.key, key) + " " + max(c.key, key)
+				if ambiguous[pair] {
+					continue
+				}
+				ambiguous[pair] = true
+				kind = Ambiguous
+			}
+			conflicts = append(conflicts, &Conflict{Kind: kind, Route: c.route, By: by.route, Path: lost[key]})
+		}
+	}
+	return conflicts
+}
+
+// notWord returns true for runes that separate the words of static sections
+func notWord(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-'
+}
+
+// tied returns true if the routes have the same priority where they first
+// differ
+func tied(a, b *ast.Route) bool {
+	for i := 0; i < len(a.Sections) && i < len(b.Sections); i++ {
+		if a.Sections[i].String() == b.Sections[i].String() {
+			continue
+		}
+		return a.Sections[i].Priority() == b.Sections[i].Priority()
+	}
+	return false
+}
+
+// preferences for the characters of example values, so regexp slots get
+// letters, digits and punctuation
+var preferences = []string{"x0aA_-", "0x", "-_x0"}
+
+// examplesOf returns example paths for each of the route's expansions. The
+// examples fill the slots with generic values for each preference, then try
+// each of the words in one slot at a time.
+func examplesOf(route *ast.Route, words []string) (examples []string) {
+	seen := map[string]bool{}
+	add := func(values []string) {
+		example := strings.Join(values, "")
+		if !seen[example] {
+			seen[example] = true
+			examples = append(examples, example)
+		}
+	}
+	for _, expanded := range route.Expand() {
+		sections := expanded.Sections
+		for _, prefer := range preferences {
+			generic := make([]string, len(sections))
+			for i, section := range sections {
+				generic[i] = exampleOf(section, prefer)
+			}
+			add(generic)
+			for i, section := range sections {
+				if _, ok := section.(ast.Slot); !ok {
+					continue
+				}
+				for _, word := range words {
+					values := slices.Clone(generic)
+					values[i] = word
+					add(values)
+				}
+			}
+		}
+	}
+	return examples
+}
+
+// exampleOf returns an example value for the section, preferring the
+// characters in prefer
+func exampleOf(section ast.Section, prefer string) string {
+	switch s := section.(type) {
+	case *ast.RegexpSlot:
+		if example := sample(s.Pattern.String(), prefer); example != "" {
+			return example
+		}
+		return "x"
+	case ast.Slot:
+		return prefer[:1]
+	default:
+		return section.String()
+	}
+}
+
+// sample returns a short string matching the regular expression
+func sample(pattern, prefer string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	writeSample(&b, re.Simplify(), prefer)
+	return b.String()
+}
+
+func writeSample(b *strings.Builder, re *syntax.Regexp, prefer string) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		b.WriteRune(classSample(re.Rune, prefer))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteRune(rune(prefer[0]))
+	case syntax.OpCapture, syntax.OpPlus:
+		writeSample(b, re.Sub[0], prefer)
+	case syntax.OpRepeat:
+		for range re.Min {
+			writeSample(b, re.Sub[0], prefer)
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			writeSample(b, sub, prefer)
+		}
+	case syntax.OpAlternate:
+		writeSample(b, re.Sub[0], prefer)
+	}
+}
+
+// classSample returns the first preferred rune in the character class ranges
+func classSample(ranges []rune, prefer string) rune {
+	for _, r := range prefer {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if ranges[i] <= r && r <= ranges[i+1] {
+				return r
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return 'x'
+	}
+	return ranges[0]
+}
@@ -0,0 +1,170 @@
+package mux
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// constraints are the built-in slot constraints, e.g. {id:int}
+var constraints = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"alpha": `[a-zA-Z]+`,
+	"slug":  `[a-zA-Z0-9]+(?:-[a-zA-Z0-9]+)*`,
+	"date":  `[0-9]{4}-[0-9]{2}-[0-9]{2}`,
+}
+
+// Constraint adds a named slot constraint, so {key:name} only matches values
+// that match the regular expression. Constraints passed to Group are only
+// available to the group's routes. The built-in constraints are int, uint,
+// uuid, alpha, slug and date.
+func Constraint(name, pattern string) Option {
+	return func(rt *Router) {
+		if rt.constraints == nil {
+			rt.constraints = map[string]string{}
+		}
+		rt.constraints[name] = pattern
+	}
+}
+
+// constraint returns the pattern of the named constraint
+func (rt *Router) constraint(name string) (string, bool) {
+	for group := rt; group != nil; group = group.parent {
+		if pattern, ok := group.constraints[name]; ok {
+			return pattern, true
+		}
+	}
+	pattern, ok := constraints[name]
+	return pattern, ok
+}
+
+// constrain rewrites constrained slots (e.g. {id:int}) into regexp slots
+// (e.g. {id|-?[0-9]+}), so invalid values don't match the route
+func (rt *Router) constrain(route string) (string, error) {
+	if !strings.Contains(route, ":") {
+		return route, nil
+	}
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(route, '{')
+		if start < 0 {
+			b.WriteString(route)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(route[start:], '}')
+		if end < 0 {
+			b.WriteString(route)
+			return b.String(), nil
+		}
+		end += start
+		slot := route[start+1 : end]
+		key, name, ok := strings.Cut(slot, ":")
+		if !ok || strings.ContainsRune(key, '|') {
+			// Copy other slots as is, including regexp slots like {id|(?:a|b)}
+			b.WriteString(route[:end+1])
+			route = route[end+1:]
+			continue
+		}
+		pattern, ok := rt.constraint(name)
+		if !ok {
+			return "", fmt.Errorf("router: unknown constraint %q in slot %q", name, slot)
+		}
+		if strings.Contains(pattern, "|") {
+			pattern = "(?:" + pattern + ")"
+		}
+		b.WriteString(route[:start])
+		b.WriteString("{" + key + "|" + pattern + "}")
+		route = route[end+1:]
+	}
+}
+
+// constrained returns the constrained slots of a route by key, e.g.
+// {"id": "{id:int}"} for /users/{id:int}
+func constrained(route string) map[string]string {
+	var slots map[string]string
+	for {
+		start := strings.IndexByte(route, '{')
+		if start < 0 {
+			return slots
+		}
+		end := strings.IndexByte(route[start:], '}')
+		if end < 0 {
+			return slots
+		}
+		end += start
+		slot := route[start+1 : end]
+		if key, _, ok := strings.Cut(slot, ":"); ok && !strings.ContainsRune(key, '|') {
+			if slots == nil {
+				slots = map[string]string{}
+			}
+			slots[key] = "{" + slot + "}"
+		}
+		route = route[end+1:]
+	}
+}
+
+// Int returns the slot's value as an int, e.g. for {id:int}. Errors map to
+// 400 Bad Request.
+func Int(r *http.Request, key string) (int, error) {
+	value, err := slotValue(r, key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, badSlot(key, "int", err)
+	}
+	return n, nil
+}
+
+// Uint returns the slot's value as a uint, e.g. for {id:uint}. Errors map to
+// 400 Bad Request.
+func Uint(r *http.Request, key string) (uint, error) {
+	value, err := slotValue(r, key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return 0, badSlot(key, "uint", err)
+	}
+	return uint(n), nil
+}
+
+// Date returns the slot's value as a date in UTC, e.g. for {day:date}. Errors
+// map to 400 Bad Request.
+func Date(r *http.Request, key string) (time.Time, error) {
+	value, err := slotValue(r, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, badSlot(key, "date", err)
+	}
+	return date, nil
+}
+
+// slotValue returns the value of the slot or an error if it's empty
+func slotValue(r *http.Request, key string) (string, error) {
+	value := r.PathValue(key)
+	if value == "" {
+		return "", &StatusError{
+			Status: http.StatusBadRequest,
+			Err:    fmt.Errorf("router: slot %q is empty", key),
+		}
+	}
+	return value, nil
+}
+
+// badSlot returns an error for a slot value that can't be parsed
+func badSlot(key, kind string, err error) error {
+	return &StatusError{
+		Status: http.StatusBadRequest,
+		Err:    fmt.Errorf("router: slot %q is not a valid %s. %w", key, kind, err),
+	}
+}
@@ -0,0 +1,137 @@
+// Package cors implements Cross-Origin Resource Sharing as router middleware.
+//
+// Preflight requests are passed through to the router, which answers OPTIONS
+// automatically for every path that has a route. The methods the router lists
+// in the Allow header are sent back as Access-Control-Allow-Methods, so there's
+// no need to register OPTIONS routes or keep a separate list of methods.
+package cors
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/livebud/mux"
+)
+
+// Config for the CORS middleware
+type Config struct {
+	// Origins allowed to make cross-origin requests. Use "*" to allow any
+	// origin.
+	Origins []string
+	// Headers the client may send in addition to the CORS-safelisted request
+	// headers. Use "*" to allow any header.
+	Headers []string
+	// Expose response headers to the client
+	Expose []string
+	// Credentials allows cookies and the Authorization header to be sent
+	Credentials bool
+	// MaxAge is how long the client may cache the preflight response
+	MaxAge time.Duration
+}
+
+// New CORS middleware. Use it on the router, or on a group to scope the policy
+// to the group's routes.
+func New(config Config) mux.Middleware {
+	return &policy{config}
+}
+
+type policy struct {
+	Config
+}
+
+func (p *policy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !p.allowOrigin(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if p.allowAnyOrigin() && !p.Credentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.Credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		// Actual request
+		if !isPreflight(r) {
+			if len(p.Expose) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(p.Expose, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Preflight request
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		if headers := p.allowHeaders(r); headers != "" {
+			header.Set("Access-Control-Allow-Headers", headers)
+		}
+		if p.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+		}
+		next.ServeHTTP(&preflightWriter{w}, r)
+	})
+}
+
+func (p *policy) allowAnyOrigin() bool {
+	return slices.Contains(p.Origins, "*")
+}
+
+func (p *policy) allowOrigin(origin string) bool {
+	for _, allowed := range p.Origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders returns the value of Access-Control-Allow-Headers. When any
+// header is allowed, the requested headers are echoed back because the
+// wildcard isn't supported for requests with credentials.
+func (p *policy) allowHeaders(r *http.Request) string {
+	if slices.Contains(p.Headers, "*") {
+		return r.Header.Get("Access-Control-Request-Headers")
+	}
+	return strings.Join(p.Headers, ", ")
+}
+
+// isPreflight returns true if the request is a CORS preflight request
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// preflightWriter copies the methods the router allows for the path into the
+// Access-Control-Allow-Methods header before the response is written
+type preflightWriter struct {
+	http.ResponseWriter
+}
+
+func (w *preflightWriter) WriteHeader(status int) {
+	w.allowMethods()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *preflightWriter) Write(p []byte) (int, error) {
+	w.allowMethods()
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *preflightWriter) allowMethods() {
+	header := w.Header()
+	if allow := header.Get("Allow"); allow != "" && header.Get("Access-Control-Allow-Methods") == "" {
+		header.Set("Access-Control-Allow-Methods", allow)
+	}
+}
+
+// Unwrap allows http.ResponseController to access the underlying writer
+func (w *preflightWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,174 @@
+package cors_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/livebud/mux"
+	"github.com/livebud/mux/cors"
+	"github.com/matryer/is"
+)
+
+func handler(route string) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(route))
+	})
+}
+
+func TestPreflight(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Use(cors.New(cors.Config{
+		Origins:     []string{"https://example.com"},
+		Headers:     []string{"Content-Type", "Authorization"},
+		Credentials: true,
+		MaxAge:      10 * time.Minute,
+	}))
+	router.Get("/users/{id}", handler("GET /users/{id}"))
+	router.Patch("/users/{id}", handler("PATCH /users/{id}"))
+	req := httptest.NewRequest(http.MethodOptions, "/users/10", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNoContent)
+	is.Equal(rec.Header().Get("Access-Control-Allow-Origin"), "https://example.com")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Methods"), "GET, HEAD, PATCH, OPTIONS")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Headers"), "Content-Type, Authorization")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Credentials"), "true")
+	is.Equal(rec.Header().Get("Access-Control-Max-Age"), "600")
+	is.Equal(rec.Header().Values("Vary"), []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"})
+}
+
+func TestPreflightHandle(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Use(cors.New(cors.Config{
+		Origins: []string{"https://example.com"},
+	}))
+	is.NoErr(router.Handle("/users/{id}", handler("/users/{id}")))
+	req := httptest.NewRequest(http.MethodOptions, "/users/10", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNoContent)
+	is.Equal(rec.Body.String(), "")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Origin"), "https://example.com")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Methods"), "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+}
+
+func TestPreflightNotFound(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Use(cors.New(cors.Config{
+		Origins: []string{"*"},
+	}))
+	router.Get("/users/{id}", handler("GET /users/{id}"))
+	req := httptest.NewRequest(http.MethodOptions, "/posts/10", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNotFound)
+	is.Equal(rec.Header().Get("Access-Control-Allow-Methods"), "")
+}
+
+func TestActualRequest(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Use(cors.New(cors.Config{
+		Origins: []string{"*"},
+		Expose:  []string{"X-Request-Id"},
+	}))
+	router.Get("/users/{id}", handler("GET /users/{id}"))
+	req := httptest.NewRequest(http.MethodGet, "/users/10", nil)
+	req.Header.Set("Origin", "https://example.com")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Body.String(), "GET /users/{id}")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Origin"), "*")
+	is.Equal(rec.Header().Get("Access-Control-Expose-Headers"), "X-Request-Id")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Credentials"), "")
+}
+
+func TestDisallowedOrigin(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Use(cors.New(cors.Config{
+		Origins: []string{"https://example.com"},
+	}))
+	router.Get("/users/{id}", handler("GET /users/{id}"))
+	req := httptest.NewRequest(http.MethodOptions, "/users/10", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNoContent)
+	is.Equal(rec.Header().Get("Access-Control-Allow-Origin"), "")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Methods"), "")
+}
+
+func TestWildcardHeadersWithCredentials(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Use(cors.New(cors.Config{
+		Origins:     []string{"*"},
+		Headers:     []string{"*"},
+		Credentials: true,
+	}))
+	router.Post("/users", handler("POST /users"))
+	req := httptest.NewRequest(http.MethodOptions, "/users", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNoContent)
+	is.Equal(rec.Header().Get("Access-Control-Allow-Origin"), "https://example.com")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Headers"), "X-Custom")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Methods"), "POST, OPTIONS")
+}
+
+func TestGroup(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Get("/", handler("GET /"))
+	api := router.Group("/api")
+	api.Use(cors.New(cors.Config{
+		Origins: []string{"https://example.com"},
+	}))
+	api.Get("/users", handler("GET /api/users"))
+	api.Post("/users", handler("POST /api/users"))
+
+	// Preflight within the group
+	req := httptest.NewRequest(http.MethodOptions, "/api/users", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNoContent)
+	is.Equal(rec.Header().Get("Access-Control-Allow-Origin"), "https://example.com")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Methods"), "GET, HEAD, POST, OPTIONS")
+
+	// Actual request within the group
+	req = httptest.NewRequest(http.MethodPost, "/api/users", nil)
+	req.Header.Set("Origin", "https://example.com")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Header().Get("Access-Control-Allow-Origin"), "https://example.com")
+
+	// Outside of the group
+	req = httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNoContent)
+	is.Equal(rec.Header().Get("Access-Control-Allow-Origin"), "")
+	is.Equal(rec.Header().Get("Access-Control-Allow-Methods"), "")
+}
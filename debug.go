@@ -0,0 +1,266 @@
+package mux
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Debug serves the router's route table for debugging, e.g.
+//
+//	router.Get("/_routes", mux.Debug(router))
+//
+// It renders the routes as an HTML table, or as JSON for requests that accept
+// application/json or pass ?format=json. The q query parameter filters the
+// routes by any of their columns, and the method and path query parameters
+// try matching a path and show its slots. Don't mount it in production, since
+// it exposes every route.
+func Debug(router *Router) http.Handler {
+	return &debugger{router}
+}
+
+type debugger struct {
+	router *Router
+}
+
+// debugTable is the route table served by Debug
+type debugTable struct {
+	Query  string        `json:"query,omitempty"`
+	Routes []*debugRoute `json:"routes"`
+	Try    *debugTry     `json:"try,omitempty"`
+}
+
+// Methods to try a path with
+func (t *debugTable) Methods() []string {
+	methods := make([]string, 0, len(methodSort))
+	for method := range methodSort {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methodSort[methods[i]] < methodSort[methods[j]]
+	})
+	return methods
+}
+
+type debugRoute struct {
+	Method     string   `json:"method"`
+	Pattern    string   `json:"pattern"`
+	Matchers   []string `json:"matchers,omitempty"`
+	Handler    string   `json:"handler"`
+	Middleware []string `json:"middleware,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	Source     string   `json:"source,omitempty"`
+}
+
+// debugTry is the result of trying to match a path
+type debugTry struct {
+	Method string       `json:"method"`
+	Path   string       `json:"path"`
+	Route  string       `json:"route,omitempty"`
+	Slots  []*debugSlot `json:"slots,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+type debugSlot struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (d *debugger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	table := &debugTable{
+		Query:  strings.TrimSpace(query.Get("q")),
+		Routes: []*debugRoute{},
+	}
+	// Routes with optional and wildcard slots are listed once per expansion
+	seen := map[string]bool{}
+	for _, route := range d.router.Routes() {
+		key := route.String() + " " + strings.Join(route.Matchers, " ")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		row := &debugRoute{
+			Method:     route.Method,
+			Pattern:    route.Host + route.Route,
+			Matchers:   route.Matchers,
+			Handler:    handlerName(route.Handler),
+			Middleware: route.Middleware,
+			Name:       route.Name,
+			Source:     route.Source,
+		}
+		if row.contains(table.Query) {
+			table.Routes = append(table.Routes, row)
+		}
+	}
+	if path := query.Get("path"); path != "" {
+		table.Try = d.try(strings.ToUpper(query.Get("method")), path)
+	}
+	if query.Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		body, err := json.MarshalIndent(table, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(body, '\n'))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := debugTemplate.Execute(w, table); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// try matching the path
+func (d *debugger) try(method, path string) *debugTry {
+	if method == "" {
+		method = http.MethodGet
+	}
+	try := &debugTry{Method: method, Path: path}
+	match, err := d.router.Match(method, path)
+	if err != nil {
+		try.Error = err.Error()
+		return try
+	}
+	try.Route = match.Route
+	for _, slot := range match.Slots {
+		try.Slots = append(try.Slots, &debugSlot{slot.Key, slot.Value})
+	}
+	return try
+}
+
+// contains returns true if any of the route's columns contain the query,
+// ignoring case
+func (r *debugRoute) contains(query string) bool {
+	if query == "" {
+		return true
+	}
+	columns := []string{r.Method, r.Pattern, r.Handler, r.Name, r.Source}
+	columns = append(columns, r.Matchers...)
+	columns = append(columns, r.Middleware...)
+	query = strings.ToLower(query)
+	for _, column := range columns {
+		if strings.Contains(strings.ToLower(column), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerName returns a readable name for the handler. Handler functions are
+// named after the function.
+func handlerName(handler http.Handler) string {
+	switch h := handler.(type) {
+	case nil:
+		return ""
+	case HandlerFunc:
+		return runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	case http.HandlerFunc:
+		return runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	default:
+		return reflect.TypeOf(handler).String()
+	}
+}
+
+// module is the import path of the router's package
+var module = reflect.TypeOf(Router{}).PkgPath()
+
+// caller returns the file:line of the first caller outside of the router and
+// its subpackages, which is where the route was registered
+func caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !internal(frame.Function) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// internal returns true if the function belongs to the router or its
+// subpackages, e.g. github.com/livebud/mux.(*Router).Get
+func internal(function string) bool {
+	// Type parameters may contain slashes and dots
+	function, _, _ = strings.Cut(function, "[")
+	slash := strings.LastIndexByte(function, '/') + 1
+	dot := strings.IndexByte(function[slash:], '.')
+	if dot < 0 {
+		return false
+	}
+	pkg := function[:slash+dot]
+	if strings.HasSuffix(pkg, "_test") {
+		return false
+	}
+	return pkg == module || strings.HasPrefix(pkg, module+"/")
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Routes</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.4em 0.6em; text-align: left; vertical-align: top; }
+td { font-family: ui-monospace, monospace; font-size: 0.9em; }
+form { margin-bottom: 1.5em; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Routes</h1>
+<form method="get">
+<select name="method">
+{{- range $method := .Methods }}
+<option{{ if and $.Try (eq $.Try.Method $method) }} selected{{ end }}>{{ $method }}</option>
+{{- end }}
+</select>
+<input name="path" placeholder="/users/10" value="{{ with .Try }}{{ .Path }}{{ end }}">
+<button>Try a path</button>
+</form>
+{{- with .Try }}
+{{- if .Error }}
+<p class="error">{{ .Error }}</p>
+{{- else }}
+<p>{{ .Method }} {{ .Path }} matches {{ .Route }}</p>
+{{- if .Slots }}
+<table>
+<tr><th>Slot</th><th>Value</th></tr>
+{{- range .Slots }}
+<tr><td>{{ .Key }}</td><td>{{ .Value }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+{{- end }}
+<form method="get">
+<input name="q" placeholder="Search routes" value="{{ .Query }}">
+<button>Search</button>
+</form>
+<table>
+<tr><th>Method</th><th>Pattern</th><th>Handler</th><th>Middleware</th><th>Name</th><th>Source</th></tr>
+{{- range .Routes }}
+<tr>
+<td>{{ .Method }}</td>
+<td>{{ .Pattern }}{{ range .Matchers }}<br>{{ . }}{{ end }}</td>
+<td>{{ .Handler }}</td>
+<td>{{ range $i, $name := .Middleware }}{{ if $i }}<br>{{ end }}{{ $name }}{{ end }}</td>
+<td>{{ .Name }}</td>
+<td>{{ .Source }}</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
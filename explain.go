@@ -0,0 +1,327 @@
+package mux
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/matthewmueller/enroute"
+	"github.com/matthewmueller/enroute/ast"
+)
+
+// Explanation of how the router matches a method and path, from Explain
+type Explanation struct {
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Match  *Match            `json:"-"`
+	Route  string            `json:"route,omitempty"` // matched route, empty if none
+	Slots  map[string]string `json:"slots,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	// Routes tried for the method in the order the router tries them, up to
+	// the route that matched
+	Tried []*Attempt `json:"tried"`
+	// Methods with a route matching the path
+	Methods []string `json:"methods"`
+	// Routes that came closest to matching, if none did
+	Closest []*Attempt `json:"closest,omitempty"`
+}
+
+// Attempt to match a route
+type Attempt struct {
+	Route   string  `json:"route"`
+	Matched string  `json:"matched"`          // start of the path the route matched
+	Reason  string  `json:"reason,omitempty"` // why the route didn't match
+	Steps   []*Step `json:"steps"`
+}
+
+// Step of an attempt, matching one section of the route
+type Step struct {
+	Section string `json:"section"`
+	Input   string `json:"input"`             // rest of the path
+	Matched string `json:"matched,omitempty"` // empty if the section didn't match
+}
+
+// Explain how the router matches the method and path. It traces the routes
+// the router tries, why each of them didn't match and which methods have a
+// route matching the path. It's meant for debugging, so it's much slower than
+// Match.
+func (rt *Router) Explain(method, path string) *Explanation {
+	methods := rt.registry.load().hosts.methods[rt.host]
+	explanation := &Explanation{
+		Method:  method,
+		Path:    path,
+		Methods: []string{},
+		Tried:   []*Attempt{},
+	}
+	if match, err := rt.Match(method, path); err != nil {
+		explanation.Error = err.Error()
+	} else {
+		explanation.Match = match
+		explanation.Route = match.Route
+		explanation.Slots = map[string]string{}
+		for _, slot := range match.Slots {
+			explanation.Slots[slot.Key] = slot.Value
+		}
+	}
+	tr, ok := methods[method]
+	if method == http.MethodHead && (!ok || !tr.matches(path)) {
+		// HEAD requests fall back to GET routes
+		tr, ok = methods[http.MethodGet]
+	}
+	var attempts []*Attempt
+	if ok {
+		attempts = tr.explain(path)
+	}
+	for _, attempt := range attempts {
+		explanation.Tried = append(explanation.Tried, attempt)
+		if attempt.Reason == "" {
+			break
+		}
+	}
+	for method, tr := range methods {
+		if tr.matches(path) {
+			explanation.Methods = append(explanation.Methods, method)
+		}
+	}
+	sort.Slice(explanation.Methods, func(i, j int) bool {
+		return methodSort[explanation.Methods[i]] < methodSort[explanation.Methods[j]]
+	})
+	if explanation.Match == nil {
+		closest := append([]*Attempt(nil), attempts...)
+		sort.SliceStable(closest, func(i, j int) bool {
+			return len(closest[i].Matched) > len(closest[j].Matched)
+		})
+		explanation.Closest = closest[:min(3, len(closest))]
+	}
+	return explanation
+}
+
+// String returns the explanation as text
+func (e *Explanation) String() string {
+	var b strings.Builder
+	if e.Match != nil {
+		fmt.Fprintf(&b, "%s %s matches %s", e.Method, e.Path, e.Route)
+	} else {
+		fmt.Fprintf(&b, "%s %s doesn't match a route: %s", e.Method, e.Path, e.Error)
+	}
+	if len(e.Tried) > 0 {
+		b.WriteString("\ntried:")
+		writeAttempts(&b, e.Tried)
+	}
+	if len(e.Methods) > 0 {
+		b.WriteString("\nmethods matching the path: " + strings.Join(e.Methods, ", "))
+	}
+	if len(e.Closest) > 0 {
+		b.WriteString("\nclosest:")
+		writeAttempts(&b, e.Closest)
+	}
+	return b.String()
+}
+
+func writeAttempts(b *strings.Builder, attempts []*Attempt) {
+	for _, attempt := range attempts {
+		if attempt.Reason == "" {
+			fmt.Fprintf(b, "\n  %s matched", attempt.Route)
+			continue
+		}
+		fmt.Fprintf(b, "\n  %s: %s", attempt.Route, attempt.Reason)
+	}
+}
+
+// ExplainHandler serves the router's explanations as JSON for debugging, e.g.
+// GET /_explain?method=GET&path=/users/10. The method defaults to GET. Don't
+// mount it in production, since it exposes every route.
+func ExplainHandler(router *Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		path := query.Get("path")
+		if path == "" {
+			http.Error(w, "router: missing the path query parameter", http.StatusBadRequest)
+			return
+		}
+		method := strings.ToUpper(query.Get("method"))
+		if method == "" {
+			method = http.MethodGet
+		}
+		body, err := json.MarshalIndent(router.Explain(method, path), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(body, '\n'))
+	})
+}
+
+// matches returns true if a route in the tree matches the path
+func (t *tree) matches(path string) bool {
+	_, err := t.Tree.Match(path)
+	return err == nil
+}
+
+// explain replays matching the path against each of the tree's routes in the
+// order the tree tries them
+func (t *tree) explain(path string) (attempts []*Attempt) {
+	// Trailing slashes are ignored
+	if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+		path = trimmed
+	} else if path != "" {
+		path = "/"
+	}
+	var routes []*ast.Route
+	named := map[*ast.Route]map[string]string{} // constrained slots by route
+	seen := map[string]bool{}
+	t.Tree.Each(func(node *enroute.Node) bool {
+		entries := t.Entries[node.Value]
+		if node.Label == "" || len(entries) == 0 || seen[node.Value] {
+			return true
+		}
+		seen[node.Value] = true
+		parsed, err := enroute.Parse(node.Value)
+		if err != nil {
+			return true
+		}
+		slots := constrained(entries[len(entries)-1].pattern)
+		for _, route := range parsed.Expand() {
+			routes = append(routes, route)
+			named[route] = slots
+		}
+		return true
+	})
+	// Slots in the same place share their delimiters in the tree, so they
+	// need to stop at the same characters when replaying. Expanded routes have
+	// no optional slots left, so their shapes only differ where the tree's do.
+	delimiters := map[string]map[byte]bool{}
+	for _, route := range routes {
+		for i, section := range route.Sections {
+			if d := delimitersOf(section); d != nil {
+				key := shapeOf(route.Sections[:i+1])
+				if delimiters[key] == nil {
+					delimiters[key] = map[byte]bool{}
+				}
+				for c := range d {
+					delimiters[key][c] = true
+				}
+			}
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return before(routes[i].Sections, routes[j].Sections)
+	})
+	for _, route := range routes {
+		attempts = append(attempts, replay(route, named[route], path, delimiters))
+	}
+	return attempts
+}
+
+// replay matching the path against the route's sections. Constrained slots
+// are shown as they were registered, e.g. {id:int}.
+func replay(route *ast.Route, named map[string]string, path string, delimiters map[string]map[byte]bool) *Attempt {
+	var label strings.Builder
+	for _, section := range route.Sections {
+		label.WriteString(sectionLabel(section, named))
+	}
+	attempt := &Attempt{Route: label.String()}
+	rest := path
+	for i, section := range route.Sections {
+		section = withDelimiters(section, delimiters[shapeOf(route.Sections[:i+1])])
+		step := &Step{Section: sectionLabel(section, named), Input: rest}
+		attempt.Steps = append(attempt.Steps, step)
+		if rest == "" {
+			attempt.Reason = fmt.Sprintf("the path ended before %s", step.Section)
+			return attempt
+		}
+		index, _ := section.Match(rest)
+		if index <= 0 {
+			attempt.Reason = mismatch(section, step.Section, rest)
+			return attempt
+		}
+		step.Matched = rest[:index]
+		rest = rest[index:]
+		attempt.Matched = path[:len(path)-len(rest)]
+	}
+	if rest != "" {
+		attempt.Reason = fmt.Sprintf("%q is left over", rest)
+	}
+	return attempt
+}
+
+// sectionLabel returns the section as it was registered
+func sectionLabel(section ast.Section, named map[string]string) string {
+	if s, ok := section.(*ast.RegexpSlot); ok && named[s.Key] != "" {
+		return named[s.Key]
+	}
+	return section.String()
+}
+
+// mismatch explains why the section labeled label didn't match the start of
+// the path
+func mismatch(section ast.Section, label, path string) string {
+	switch s := section.(type) {
+	case *ast.RegexpSlot:
+		value := path[:delimiterAt(s.Delimiters, path)]
+		if value == "" {
+			return fmt.Sprintf("%s is empty at %q", label, path)
+		}
+		return fmt.Sprintf("%s rejected %q", label, value)
+	case ast.Slot:
+		return fmt.Sprintf("%s is empty at %q", label, path)
+	default:
+		return fmt.Sprintf("expected %q at %q", label, path)
+	}
+}
+
+// delimiterAt returns the index of the first delimiter in the path
+func delimiterAt(delimiters map[byte]bool, path string) int {
+	for i := 0; i < len(path); i++ {
+		if delimiters[path[i]] {
+			return i
+		}
+	}
+	return len(path)
+}
+
+// delimitersOf returns the delimiters of slots that stop at them
+func delimitersOf(section ast.Section) map[byte]bool {
+	switch s := section.(type) {
+	case *ast.RequiredSlot:
+		return s.Delimiters
+	case *ast.OptionalSlot:
+		return s.Delimiters
+	case *ast.RegexpSlot:
+		return s.Delimiters
+	default:
+		return nil
+	}
+}
+
+// withDelimiters returns a copy of the slot with the delimiters
+func withDelimiters(section ast.Section, delimiters map[byte]bool) ast.Section {
+	if delimiters == nil {
+		return section
+	}
+	switch s := section.(type) {
+	case *ast.RequiredSlot:
+		return &ast.RequiredSlot{Key: s.Key, Delimiters: delimiters}
+	case *ast.RegexpSlot:
+		return &ast.RegexpSlot{Key: s.Key, Pattern: s.Pattern, Delimiters: delimiters}
+	default:
+		return section
+	}
+}
+
+// before returns true if the tree tries the route with sections a before b:
+// at the first section that differs, static sections come before regexp
+// slots, which come before slots and wildcard slots. Routes that end first
+// come before the routes that continue them.
+func before(a, b ast.Sections) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if shapeOf(a[i:i+1]) == shapeOf(b[i:i+1]) {
+			continue
+		}
+		return a[i].Priority() > b[i].Priority()
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,86 @@
+package mux
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// headResponseWriter discards the body written by a GET handler that's
+// answering a HEAD request. The headers are held back until the handler
+// returns so Content-Length can reflect the body that would have been sent,
+// unless the handler flushes first.
+type headResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	length  int
+	flushed bool // headers were written to the underlying writer
+}
+
+var _ http.ResponseWriter = (*headResponseWriter)(nil)
+var _ http.Flusher = (*headResponseWriter)(nil)
+
+func (w *headResponseWriter) WriteHeader(status int) {
+	// Informational responses like 103 Early Hints aren't the final status
+	if status >= 100 && status <= 199 && status != http.StatusSwitchingProtocols {
+		if !w.flushed {
+			w.ResponseWriter.WriteHeader(status)
+		}
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *headResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	// Sniff the content type just like net/http would have
+	header := w.Header()
+	if _, ok := header["Content-Type"]; !ok && w.length == 0 && len(p) > 0 {
+		header.Set("Content-Type", http.DetectContentType(p))
+	}
+	w.length += len(p)
+	return len(p), nil
+}
+
+// Flush writes the held headers to the underlying writer, so streaming
+// handlers answer HEAD requests right away. Content-Length is left out, since
+// the length of the body isn't known yet.
+func (w *headResponseWriter) Flush() {
+	w.writeHeader()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to access the underlying writer
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flush writes the headers to the underlying response writer once the handler
+// returns, with the length of the body that would have been sent
+func (w *headResponseWriter) flush() {
+	if w.flushed {
+		return
+	}
+	header := w.Header()
+	if header.Get("Content-Length") == "" && header.Get("Transfer-Encoding") == "" && w.length > 0 {
+		header.Set("Content-Length", strconv.Itoa(w.length))
+	}
+	w.writeHeader()
+}
+
+// writeHeader writes the held status and headers once
+func (w *headResponseWriter) writeHeader() {
+	if w.flushed {
+		return
+	}
+	w.flushed = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
@@ -0,0 +1,136 @@
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/matthewmueller/enroute"
+)
+
+// Host scopes the routes registered through the returned router to requests
+// whose host matches the pattern (e.g. "{tenant}.example.com"). Host slots are
+// available just like path slots. Requests that don't match a host pattern fall
+// back to the routes without a host. Ports are ignored.
+func (rt *Router) Host(pattern string) *Router {
+	group := rt.Group("")
+	group.host = normalizeHost(pattern)
+	return group
+}
+
+// hosts holds the routes for every host pattern. Routes without a host are
+// stored under the empty pattern.
+type hosts struct {
+	tree    *enroute.Tree
+	methods map[string]map[string]*tree // host pattern => method => tree
+	known   map[string]bool             // host patterns inserted into the tree
+}
+
+// insert the host pattern into the host tree, if it's not already there
+func (h *hosts) insert(pattern string) error {
+	if pattern == "" || h.known[pattern] {
+		return nil
+	}
+	if err := h.tree.Insert("/"+pattern, pattern); err != nil {
+		return fmt.Errorf("router: invalid host %q. %w", pattern, err)
+	}
+	if h.known == nil {
+		h.known = map[string]bool{}
+	}
+	h.known[pattern] = true
+	return nil
+}
+
+// scope is a set of method trees that may contain a route for a request
+type scope struct {
+	host    string
+	slots   []*enroute.Slot
+	methods map[string]*tree
+}
+
+// scopes returns the method trees to search for a host, starting with the
+// routes of the matching host pattern, then the routes without a host
+func (h *hosts) scopes(host string) (scopes []*scope) {
+	if scope, ok := h.scope(host); ok {
+		scopes = append(scopes, scope)
+	}
+	return append(scopes, &scope{"", nil, h.methods[""]})
+}
+
+// scope returns the routes of the host pattern matching the host
+func (h *hosts) scope(host string) (*scope, bool) {
+	if len(h.known) == 0 {
+		return nil, false
+	}
+	if host = normalizeHost(host); host == "" {
+		return nil, false
+	}
+	m, err := h.tree.Match("/" + host)
+	if err != nil {
+		return nil, false
+	}
+	return &scope{m.Value, m.Slots, h.methods[m.Value]}, true
+}
+
+// match a route for the host, method and path. Routes without a host are
+// matched without allocating.
+func (h *hosts) match(method, host, path string) (*Match, error) {
+	if scope, ok := h.scope(host); ok {
+		match, err := matchMethods(scope.methods, method, path)
+		if err == nil {
+			// Copy the match, since it may be shared
+			m := *match
+			m.Host = scope.host
+			m.Slots = append(slices.Clone(scope.slots), m.Slots...)
+			m.static = false
+			return &m, nil
+		} else if !errors.Is(err, ErrNoMatch) {
+			return nil, err
+		}
+	}
+	match, err := matchMethods(h.methods[""], method, path)
+	if err != nil {
+		if errors.Is(err, ErrNoMatch) {
+			return nil, fmt.Errorf("router: %w found for %s %s%s", ErrNoMatch, method, host, path)
+		}
+		return nil, err
+	}
+	return match, nil
+}
+
+// allow returns the methods that have a route matching the host and path
+func (h *hosts) allow(host, path string) (methods []string) {
+	for _, scope := range h.scopes(host) {
+		for _, method := range allow(scope.methods, path) {
+			if !slices.Contains(methods, method) {
+				methods = append(methods, method)
+			}
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methodSort[methods[i]] < methodSort[methods[j]]
+	})
+	return methods
+}
+
+// owner returns the router or group that registered the first route matching
+// the host and path within the allowed methods
+func (h *hosts) owner(allow []string, host, path string) *Router {
+	for _, scope := range h.scopes(host) {
+		if router, ok := owner(scope.methods, allow, path); ok {
+			return router
+		}
+	}
+	return nil
+}
+
+// normalizeHost lowercases the host and strips the port and trailing dot
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
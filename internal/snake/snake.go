@@ -0,0 +1,28 @@
+// Package snake converts names into the snake_case slots the router supports
+package snake
+
+import "strings"
+
+// Case converts the name to snake_case, e.g. userID to user_id
+func Case(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			// Only start a word after a lowercase letter or digit, so ID stays id
+			if i > 0 && !isUpper(name[i-1]) && name[i-1] != '_' {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r + 'a' - 'A')
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,302 @@
+package mux
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSON creates a handler that binds the request to In, calls fn and encodes
+// the result as JSON. In is decoded from the request body, then fields tagged
+// with `path:"id"` and `query:"page"` are set from path slots and query
+// values. Path fields are required, while json and query fields are required
+// when their tag ends with ",required" (e.g. `json:"name,required"`). Required
+// json fields must be in the body, but may be zero values like 0 or "". Binding
+// errors map to 400 Bad Request and errors returned by fn are written by the
+// router's error handler.
+//
+// JSON panics if a path or query field has a type it can't bind.
+func JSON[In, Out any](fn func(ctx context.Context, in In) (Out, error)) *JSONHandler[In, Out] {
+	bindings, err := bindingsOf(reflect.TypeFor[In]())
+	if err != nil {
+		panic(err)
+	}
+	return &JSONHandler[In, Out]{fn, bindings}
+}
+
+// JSONHandler is a typed handler created by JSON
+type JSONHandler[In, Out any] struct {
+	fn       func(ctx context.Context, in In) (Out, error)
+	bindings []*binding
+}
+
+var _ http.Handler = (*JSONHandler[struct{}, struct{}])(nil)
+
+// ServeHTTP implements http.Handler. Outside of a router, errors are written
+// with the default error handler.
+func (h *JSONHandler[In, Out]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.serve(w, r); err != nil {
+		writeError(w, r, err)
+	}
+}
+
+// Types returns the input and output types, so tools like the openapi package
+// can describe the handler
+func (h *JSONHandler[In, Out]) Types() (in, out reflect.Type) {
+	return reflect.TypeFor[In](), reflect.TypeFor[Out]()
+}
+
+func (h *JSONHandler[In, Out]) serve(w http.ResponseWriter, r *http.Request) error {
+	in, err := h.bind(r)
+	if err != nil {
+		return err
+	}
+	out, err := h.fn(r.Context(), in)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("router: unable to encode the response. %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+	return nil
+}
+
+// bind the request to the input
+func (h *JSONHandler[In, Out]) bind(r *http.Request) (in In, err error) {
+	var body json.RawMessage
+	if r.Body != nil && r.Body != http.NoBody {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			return in, badRequest("router: unable to decode the request body. %s", err)
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &in); err != nil {
+				return in, badRequest("router: unable to decode the request body. %s", err)
+			}
+		}
+	}
+	if len(h.bindings) == 0 {
+		return in, nil
+	}
+	v := reflect.ValueOf(&in).Elem()
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	var query map[string][]string
+	var keys map[string]json.RawMessage
+	var problems []string
+	for _, b := range h.bindings {
+		field := v.FieldByIndex(b.index)
+		var values []string
+		switch b.source {
+		case "path":
+			if value := r.PathValue(b.key); value != "" {
+				values = []string{value}
+			}
+		case "query":
+			if query == nil {
+				query = r.URL.Query()
+			}
+			values = query[b.key]
+		case "json":
+			// Decoded from the body, so only check that it's there. Zero values
+			// like 0, false and "" count, while null doesn't.
+			if keys == nil {
+				// Bodies that aren't objects have no keys
+				keys = map[string]json.RawMessage{}
+				json.Unmarshal(body, &keys)
+			}
+			if value, ok := lookupKey(keys, b.key); !ok || string(value) == "null" {
+				problems = append(problems, fmt.Sprintf("%s %q is required", b.source, b.key))
+			}
+			continue
+		}
+		if len(values) == 0 {
+			if b.required {
+				problems = append(problems, fmt.Sprintf("%s %q is required", b.source, b.key))
+			}
+			continue
+		}
+		if err := setField(field, values); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %q is not a valid %s", b.source, b.key, field.Type()))
+		}
+	}
+	if len(problems) > 0 {
+		return in, badRequest("router: %s", strings.Join(problems, ", "))
+	}
+	return in, nil
+}
+
+// lookupKey returns the value of the key, matching keys without regard to case
+// like encoding/json does when decoding into a struct
+func lookupKey(keys map[string]json.RawMessage, key string) (json.RawMessage, bool) {
+	if value, ok := keys[key]; ok {
+		return value, true
+	}
+	for k, value := range keys {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// binding of a struct field to part of the request
+type binding struct {
+	index    []int
+	source   string // path, query or json
+	key      string
+	required bool
+}
+
+// bindingsOf returns the bindings of the struct's fields
+func bindingsOf(t reflect.Type) (bindings []*binding, err error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		for _, source := range []string{"path", "query", "json"} {
+			tag, ok := field.Tag.Lookup(source)
+			if !ok {
+				continue
+			}
+			key, options, _ := strings.Cut(tag, ",")
+			if key == "-" {
+				continue
+			}
+			if key == "" {
+				key = field.Name
+			}
+			b := &binding{
+				index:    field.Index,
+				source:   source,
+				key:      key,
+				required: source == "path" || hasOption(options, "required"),
+			}
+			if source == "json" {
+				if b.required {
+					bindings = append(bindings, b)
+				}
+				continue
+			}
+			if !canSet(field.Type, source == "query") {
+				return nil, fmt.Errorf("router: unable to bind %s %q to field %s of type %s", source, key, field.Name, field.Type)
+			}
+			bindings = append(bindings, b)
+		}
+	}
+	return bindings, nil
+}
+
+// hasOption returns true if the comma-separated tag options contain option
+func hasOption(options, option string) bool {
+	for o := range strings.SplitSeq(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+var textUnmarshaler = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+// canSet returns true if setField can set a field of the type. Slices are
+// allowed for query values, which can repeat.
+func canSet(t reflect.Type, slice bool) bool {
+	if reflect.PointerTo(t).Implements(textUnmarshaler) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Pointer:
+		return canSet(t.Elem(), false)
+	case reflect.Slice:
+		return slice && canSet(t.Elem(), false)
+	default:
+		return false
+	}
+}
+
+// setField parses the values into the field
+func setField(field reflect.Value, values []string) error {
+	if field.Addr().Type().Implements(textUnmarshaler) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+	}
+	value := values[0]
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	case reflect.Pointer:
+		ptr := reflect.New(field.Type().Elem())
+		if err := setField(ptr.Elem(), values); err != nil {
+			return err
+		}
+		field.Set(ptr)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i := range values {
+			if err := setField(slice.Index(i), values[i:i+1]); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	default:
+		return fmt.Errorf("router: unable to set %s", field.Type())
+	}
+	return nil
+}
+
+// badRequest returns an error that maps to 400 Bad Request
+func badRequest(format string, args ...any) error {
+	return &StatusError{
+		Status: http.StatusBadRequest,
+		Err:    fmt.Errorf(format, args...),
+	}
+}
@@ -1,10 +1,14 @@
 package mux
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"path"
+	"reflect"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
 
@@ -27,6 +31,77 @@ func (fn Use) Middleware(next http.Handler) http.Handler {
 	return fn(next)
 }
 
+// HandlerFunc is a handler that returns an error. Returned errors are written
+// by the error handler of the router or group the route is registered on, just
+// like the errors of JSON handlers.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP implements http.Handler. Outside of a router, errors are written
+// with the default error handler.
+func (fn HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := fn(w, r); err != nil {
+		writeError(w, r, err)
+	}
+}
+
+func (fn HandlerFunc) serve(w http.ResponseWriter, r *http.Request) error {
+	return fn(w, r)
+}
+
+// Serve the request with the handler, returning the errors of HandlerFunc and
+// JSON handlers instead of writing them. Handlers that wrap other handlers in
+// a HandlerFunc use it to pass errors on to the router.
+func Serve(w http.ResponseWriter, r *http.Request, handler http.Handler) error {
+	if h, ok := handler.(errorHandler); ok {
+		return h.serve(w, r)
+	}
+	handler.ServeHTTP(w, r)
+	return nil
+}
+
+// errorHandler is a handler that returns errors for the router to write
+type errorHandler interface {
+	serve(w http.ResponseWriter, r *http.Request) error
+}
+
+// StatusError is an error with an HTTP status code
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Status)
+	}
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// StatusOf maps an error to an HTTP status code. Errors without a status map
+// to 500 Internal Server Error.
+func StatusOf(err error) int {
+	var statusError *StatusError
+	var problem *Problem
+	switch {
+	case errors.As(err, &statusError):
+		return statusError.Status
+	case errors.As(err, &problem):
+		return problem.status()
+	case errors.Is(err, ErrNoMatch):
+		return http.StatusNotFound
+	case errors.Is(err, errNotAcceptable):
+		return http.StatusNotAcceptable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // Routes interface for defining routes
 type Routes interface {
 	Use(mw Middleware)
@@ -45,36 +120,145 @@ type Mountable interface {
 
 type Match struct {
 	Method  string
+	Host    string // host pattern, empty for routes without a host
 	Route   string
 	Path    string
 	Slots   []*enroute.Slot
 	Handler http.Handler
+	// MediaType is the negotiated media type for routes that Accept media types
+	MediaType string
+	router    *Router  // router or group that registered the handler
+	entry     *entry   // chosen candidate
+	entries   []*entry // candidates sharing the route
+	pattern   string   // method and route, e.g. GET /users/{id}
+	static    bool     // shared match for a route without slots or matchers
+}
+
+// Option configures the router. Options passed to Group override the
+// router's options for the group's routes.
+type Option func(rt *Router)
+
+// NotFound sets the handler that's called when no route matches the path
+func NotFound(handler http.Handler) Option {
+	return func(rt *Router) {
+		rt.notFound = handler
+	}
+}
+
+// MethodNotAllowed sets the handler that's called when the path matches a
+// route, but not for the request's method. The Allow header is set before the
+// handler is called.
+func MethodNotAllowed(handler http.Handler) Option {
+	return func(rt *Router) {
+		rt.methodNotAllowed = handler
+	}
+}
+
+// NotAcceptable sets the handler that's called when the route's handlers don't
+// produce a media type the request accepts
+func NotAcceptable(handler http.Handler) Option {
+	return func(rt *Router) {
+		rt.notAcceptable = handler
+	}
+}
+
+// InternalError sets the function that's called when routing fails for reasons
+// other than a missing route
+func InternalError(fn func(w http.ResponseWriter, r *http.Request, err error)) Option {
+	return func(rt *Router) {
+		rt.internalError = fn
+	}
+}
+
+// ErrorHandler sets the function that writes the errors returned by
+// HandlerFunc handlers. Use StatusOf to map errors to status codes.
+func ErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) Option {
+	return func(rt *Router) {
+		rt.errorHandler = fn
+	}
+}
+
+// QuerySlots also copies the matched slots into the request's query string,
+// overwriting query parameters with the same name. This was the default
+// behavior before slots were available through r.PathValue.
+func QuerySlots() Option {
+	return func(rt *Router) {
+		rt.querySlots = true
+	}
+}
+
+type matchKey struct{}
+
+// MatchFrom returns the match stored in the context by the router. Slots are
+// also available through r.PathValue. Routes without slots or matchers share
+// one match between requests, so don't modify it. Other routes get a new match
+// for every request rather than a pooled one, since the match may outlive the
+// handler, e.g. under http.TimeoutHandler.
+func MatchFrom(ctx context.Context) (*Match, bool) {
+	match, ok := ctx.Value(matchKey{}).(*Match)
+	return match, ok
 }
 
-func New() *Router {
-	return &Router{
-		base:    "",
-		methods: map[string]*tree{},
+func New(options ...Option) *Router {
+	rt := &Router{
+		base:             "",
+		notFound:         http.NotFoundHandler(),
+		methodNotAllowed: http.HandlerFunc(methodNotAllowed),
+		notAcceptable:    http.HandlerFunc(notAcceptable),
+		internalError:    internalError,
+		errorHandler:     writeError,
+	}
+	rt.registry = newRegistry(rt)
+	for _, option := range options {
+		option(rt)
 	}
+	return rt
 }
 
 type Router struct {
-	base    string
-	stack   []Middleware
-	methods map[string]*tree
+	base             string
+	parent           *Router
+	stack            []Middleware
+	routeStack       []Middleware // middleware that runs after a route matches
+	host             string       // host pattern of routes registered through this router
+	name             string       // name given to routes registered through this router
+	registry         *registry
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+	notAcceptable    http.Handler
+	internalError    func(w http.ResponseWriter, r *http.Request, err error)
+	errorHandler     func(w http.ResponseWriter, r *http.Request, err error)
+	querySlots       bool
+	constraints      map[string]string // slot constraint name => pattern
+	batch            *batch            // batch the routes are added to, if any
 }
 
 var _ http.Handler = (*Router)(nil)
 var _ Routes = (*Router)(nil)
 
-// Use middleware
+// Use middleware. Middleware used on the router runs on every request,
+// including requests that don't match a route. Middleware used on a group only
+// wraps the handlers registered through that group.
 func (rt *Router) Use(fn Middleware) {
-	rt.stack = append(rt.stack, fn)
+	rt.registry.change(func() {
+		rt.stack = append(rt.stack, fn)
+	})
 }
 
-// Mount routes
+// UseRoute adds middleware that runs after a route matches and before the
+// group middleware of nested groups. Unlike router middleware, it doesn't run
+// on requests that don't match a route. The match is available through
+// MatchFrom and r.Pattern (e.g. "GET /users/{id}"), which makes it a good fit
+// for logging and metrics.
+func (rt *Router) UseRoute(fn Middleware) {
+	rt.registry.change(func() {
+		rt.routeStack = append(rt.routeStack, fn)
+	})
+}
+
+// Mount routes. Middleware used by the mountable is scoped to its routes.
 func (rt *Router) Mount(m Mountable) {
-	m.Mount(rt)
+	m.Mount(rt.Group(""))
 }
 
 // Get route
@@ -112,111 +296,542 @@ func (rt *Router) Set(method string, route string, handler http.Handler) error {
 
 // Set the route
 func (rt *Router) set(method, route string, handler http.Handler) error {
-	return rt.insert(method, path.Join(rt.base, route), handler)
+	return rt.add(method, route, &entry{
+		handler: handler,
+		router:  rt,
+		name:    rt.name,
+	})
+}
+
+// add the entry under the route relative to the router's base
+func (rt *Router) add(method, route string, e *entry) error {
+	pattern := path.Join(rt.base, route)
+	route, err := rt.constrain(pattern)
+	if err != nil {
+		return err
+	}
+	if route != pattern {
+		e.pattern = pattern
+	}
+	e.source = caller()
+	if rt.batch != nil {
+		return rt.batch.add(&record{method, rt.host, route, e})
+	}
+	return rt.registry.add(&record{method, rt.host, route, e})
+}
+
+// Batch adds the routes registered through the router passed to fn together,
+// once fn returns. If fn returns an error or a route can't be added, none of
+// the routes are. Requests never see some of the routes without the others.
+//
+// Routes can't be replaced or removed through the batch router.
+func (rt *Router) Batch(fn func(batch *Router) error) error {
+	group := rt.Group("")
+	group.batch = rt.registry.batch()
+	if err := fn(group); err != nil {
+		return err
+	}
+	return group.batch.commit()
+}
+
+// Replace the handler for a route, or add it if the route doesn't exist yet.
+// Unlike removing and re-adding the route, requests never see the route
+// missing. Routes can be added, replaced and removed while serving requests.
+func (rt *Router) Replace(method, route string, handler http.Handler) error {
+	if !isMethod(method) {
+		return fmt.Errorf("router: %q is not a valid HTTP method", method)
+	}
+	if rt.batch != nil {
+		return errBatch
+	}
+	pattern := path.Join(rt.base, route)
+	route, err := rt.constrain(pattern)
+	if err != nil {
+		return err
+	}
+	e := &entry{
+		handler: handler,
+		router:  rt,
+		name:    rt.name,
+		source:  caller(),
+	}
+	if route != pattern {
+		e.pattern = pattern
+	}
+	return rt.registry.replace(&record{method, rt.host, route, e})
+}
+
+// Remove the handlers for a route, including handlers registered with request
+// matchers. Routes can be removed while serving requests.
+func (rt *Router) Remove(method, route string) error {
+	if rt.batch != nil {
+		return errBatch
+	}
+	route, err := rt.constrain(path.Join(rt.base, route))
+	if err != nil {
+		return err
+	}
+	return rt.registry.remove(method, rt.host, route)
+}
+
+var errBatch = errors.New("router: routes can't be replaced or removed in a batch")
+
+// Group routes within a route. The group shares routes with the router, but
+// has its own middleware stack. Options override the router's handlers for
+// requests within the group, e.g. to respond to missing /api routes with JSON.
+func (rt *Router) Group(route string, options ...Option) *Router {
+	group := &Router{
+		base:     strings.TrimSuffix(path.Join(rt.base, route), "/"),
+		parent:   rt,
+		host:     rt.host,
+		registry: rt.registry,
+		batch:    rt.batch,
+	}
+	if len(options) > 0 {
+		rt.registry.change(func() {
+			for _, option := range options {
+				option(group)
+			}
+			rt.registry.groups = append(rt.registry.groups, group)
+		})
+	}
+	return group
+}
+
+// Name the routes registered through the returned router, so their URLs can be
+// built with URL. Routes sharing a name must share the same path.
+func (rt *Router) Name(name string) *Router {
+	group := rt.Group("")
+	group.name = name
+	return group
+}
+
+// With returns a view of the router whose routes are wrapped in the
+// middleware. The middleware runs after the route matches and is reported by
+// Routes, e.g. router.With(auth).Get("/admin", handler).
+func (rt *Router) With(stack ...Middleware) *Router {
+	group := rt.Group("")
+	group.stack = slices.Clone(stack)
+	return group
+}
+
+// root returns the top-level router
+func (rt *Router) root() *Router {
+	for rt.parent != nil {
+		rt = rt.parent
+	}
+	return rt
+}
+
+// wrap the handler in the middleware of this group and its parent groups. The
+// root router's middleware already ran before matching, so it's not included.
+func (rt *Router) wrap(handler http.Handler) http.Handler {
+	for group := rt; group.parent != nil; group = group.parent {
+		handler = Compose(group.stack...).Middleware(handler)
+	}
+	return handler
+}
+
+// lookup returns the first handler set on the group or its parent groups. The
+// root router's handlers aren't included.
+func (rt *Router) lookup(handler func(group *Router) http.Handler) http.Handler {
+	for group := rt; group != nil && group.parent != nil; group = group.parent {
+		if h := handler(group); h != nil {
+			return h
+		}
+	}
+	return nil
+}
+
+// routingError calls the internal error function of the group or its parents
+func (rt *Router) routingError(w http.ResponseWriter, r *http.Request, err error) {
+	for group := rt; group != nil; group = group.parent {
+		if group.internalError != nil {
+			group.internalError(w, r, err)
+			return
+		}
+	}
+	internalError(w, r, err)
+}
+
+// handleErrors writes the errors returned by fn with the error handler of the
+// group or its parents
+func (rt *Router) handleErrors(fn HandlerFunc) http.Handler {
+	handle := writeError
+	for group := rt; group != nil; group = group.parent {
+		if group.errorHandler != nil {
+			handle = group.errorHandler
+			break
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(w, r); err != nil {
+			handle(w, r, err)
+		}
+	})
 }
 
-// Group routes within a route
-func (rt *Router) Group(route string) *Router {
-	return &Router{
-		base:    strings.TrimSuffix(path.Join(rt.base, route), "/"),
-		stack:   rt.stack,
-		methods: rt.methods,
+// addsQuerySlots returns true if the group or its parents copy slots into the
+// query string
+func (rt *Router) addsQuerySlots() bool {
+	for group := rt; group != nil; group = group.parent {
+		if group.querySlots {
+			return true
+		}
 	}
+	return false
 }
 
-// ServeHTTP implements http.Handler
+// chain wraps a route's handler in the route and group middleware of this
+// group and its parent groups
+func (rt *Router) chain(handler http.Handler) http.Handler {
+	if h, ok := handler.(errorHandler); ok {
+		handler = rt.handleErrors(h.serve)
+	}
+	for group := rt; group != nil; group = group.parent {
+		if len(group.routeStack) > 0 {
+			handler = Compose(group.routeStack...).Middleware(handler)
+		}
+		if group.parent != nil {
+			handler = Compose(group.stack...).Middleware(handler)
+		}
+	}
+	return handler
+}
+
+// middleware returns the names of the middleware that chain wraps handlers
+// in, outermost first
+func (rt *Router) middleware() (names []string) {
+	for group := rt; group != nil; group = group.parent {
+		var stack []Middleware
+		if group.parent != nil {
+			stack = append(stack, group.stack...)
+		}
+		stack = append(stack, group.routeStack...)
+		for i := len(stack) - 1; i >= 0; i-- {
+			names = append(names, nameOf(stack[i]))
+		}
+	}
+	slices.Reverse(names)
+	return names
+}
+
+// nameOf returns a readable name for the middleware. Middleware can name
+// itself by implementing fmt.Stringer.
+func nameOf(mw Middleware) string {
+	switch mw := mw.(type) {
+	case fmt.Stringer:
+		return mw.String()
+	case Use:
+		return runtime.FuncForPC(reflect.ValueOf(mw).Pointer()).Name()
+	default:
+		return reflect.TypeOf(mw).String()
+	}
+}
+
+// ServeHTTP implements http.Handler. The middleware is composed once and
+// recomposed after middleware is used or routes change.
 func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	handler := rt.Middleware(http.NotFoundHandler())
-	handler.ServeHTTP(w, r)
+	rt.registry.load().handler.ServeHTTP(w, r)
 }
 
 // Middleware turns the router into middleware where if there are no matches
-// it will call the next middleware in the stack
+// it will call the next middleware in the stack. If the path matches a route
+// under a different method, OPTIONS requests are answered automatically and
+// other methods call the method not allowed handler.
 func (rt *Router) Middleware(next http.Handler) http.Handler {
+	rt = rt.root()
 	stack := Compose(rt.stack...)
 	return stack.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Match the path
-		match, err := rt.Match(r.Method, r.URL.Path)
+		// Match the host and path
+		table := rt.registry.load()
+		hosts := table.hosts
+		match, err := hosts.match(r.Method, r.Host, r.URL.Path)
 		if err != nil {
-			if errors.Is(err, enroute.ErrNoMatch) {
-				next.ServeHTTP(w, r)
+			// The innermost group with options containing the path handles errors
+			group := table.group(r.Host, r.URL.Path)
+			if !errors.Is(err, enroute.ErrNoMatch) {
+				if group == nil {
+					group = rt
+				}
+				group.routingError(w, r, err)
+				return
+			}
+			if allow := hosts.allow(r.Host, r.URL.Path); len(allow) > 0 {
+				w.Header().Set("Allow", strings.Join(allow, ", "))
+				owner := hosts.owner(allow, r.Host, r.URL.Path)
+				if r.Method == http.MethodOptions {
+					// Run through the middleware of the group that owns the path, so
+					// group middleware like CORS can respond to preflight requests
+					handler, ok := table.options[owner]
+					if !ok {
+						handler = http.HandlerFunc(noContent)
+					}
+					handler.ServeHTTP(w, r)
+					return
+				}
+				handler := owner.lookup(func(group *Router) http.Handler { return group.methodNotAllowed })
+				if handler == nil {
+					handler = rt.methodNotAllowed
+				}
+				handler.ServeHTTP(w, r)
+				return
+			}
+			if handler := group.lookup(func(group *Router) http.Handler { return group.notFound }); handler != nil {
+				handler.ServeHTTP(w, r)
 				return
 			}
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			next.ServeHTTP(w, r)
 			return
 		}
+		// Static routes have nothing to choose, so their shared match is stored
+		// as is
+		if !match.static {
+			// Pick the handler whose matchers match the request
+			if match.negotiates() {
+				w.Header().Add("Vary", "Accept")
+			}
+			if err := match.choose(r); err != nil {
+				if errors.Is(err, errNotAcceptable) {
+					handler := match.router.lookup(func(group *Router) http.Handler { return group.notAcceptable })
+					if handler == nil {
+						handler = rt.notAcceptable
+					}
+					handler.ServeHTTP(w, r)
+					return
+				}
+				// None of the matchers matched, so the path is missing like
+				// any other
+				group := table.group(r.Host, r.URL.Path)
+				if handler := group.lookup(func(group *Router) http.Handler { return group.notFound }); handler != nil {
+					handler.ServeHTTP(w, r)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		// Make the match available to the handler. This costs static routes
+		// their only two allocations, a context value and a copy of the
+		// request, which MatchFrom needs.
+		r = r.WithContext(context.WithValue(r.Context(), matchKey{}, match))
+		r.Pattern = match.pattern
+		for _, slot := range match.Slots {
+			r.SetPathValue(slot.Key, slot.Value)
+		}
 		// Add the slots as query params
-		if len(match.Slots) > 0 {
+		if len(match.Slots) > 0 && match.router.addsQuerySlots() {
 			query := r.URL.Query()
 			for _, slot := range match.Slots {
 				query.Set(slot.Key, slot.Value)
 			}
 			r.URL.RawQuery = query.Encode()
 		}
-		match.Handler.ServeHTTP(w, r)
+		handler, ok := table.chains[match.entry]
+		if !ok {
+			handler = match.router.chain(match.Handler)
+		}
+		// Discard the body when a GET route is answering a HEAD request
+		if r.Method == http.MethodHead && match.Method == http.MethodGet {
+			hw := &headResponseWriter{ResponseWriter: w}
+			handler.ServeHTTP(hw, r)
+			hw.flush()
+			return
+		}
+		handler.ServeHTTP(w, r)
 	}))
 }
 
 type Route struct {
-	Method  string
-	Route   string
-	Handler http.Handler
+	Method   string
+	Host     string
+	Route    string
+	Name     string
+	Matchers []string // request matchers, e.g. `header X-Api-Version=2`
+	// Middleware wrapping the handler after the route matches, outermost first.
+	// Router middleware that runs before matching isn't included.
+	Middleware []string
+	Handler    http.Handler
+	Source     string // file:line where the route was registered
+	route      string // route in the tree
+	entry      *entry
 }
 
 func (r *Route) String() string {
-	return fmt.Sprintf("%s %s", r.Method, r.Route)
+	return fmt.Sprintf("%s %s%s", r.Method, r.Host, r.Route)
+}
+
+// Regexp returns the route with its constrained slots rewritten into the
+// regexp slots they match, e.g. /users/{id|^-?[0-9]+$} for /users/{id:int}
+func (r *Route) Regexp() string {
+	if r.route == "" {
+		return r.Route
+	}
+	return r.route
 }
 
 func (rt *Router) Find(method, route string) (*Route, error) {
-	tree, ok := rt.methods[method]
+	route, err := rt.constrain(route)
+	if err != nil {
+		return nil, err
+	}
+	table := rt.registry.load()
+	tree, ok := table.hosts.methods[rt.host][method]
 	if !ok {
 		return nil, fmt.Errorf("router: %w found for %s %s", ErrNoMatch, method, route)
 	}
-	return tree.Find(method, route)
+	found, err := tree.Find(method, route)
+	if err != nil {
+		return nil, err
+	}
+	found.Middleware = table.middleware[found.entry]
+	return found, nil
 }
 
 var methodSort = map[string]int{
-	http.MethodGet:    0,
-	http.MethodPost:   1,
-	http.MethodPut:    2,
-	http.MethodPatch:  3,
-	http.MethodDelete: 4,
+	http.MethodGet:     0,
+	http.MethodHead:    1,
+	http.MethodPost:    2,
+	http.MethodPut:     3,
+	http.MethodPatch:   4,
+	http.MethodDelete:  5,
+	http.MethodConnect: 6,
+	http.MethodOptions: 7,
+	http.MethodTrace:   8,
 }
 
 // Routes lists all the routes
 func (rt *Router) Routes() (routes []*Route) {
-	for method, tree := range rt.methods {
-		routes = append(routes, tree.Routes(method)...)
+	table := rt.registry.load()
+	for host, methods := range table.hosts.methods {
+		for method, tree := range methods {
+			for _, route := range tree.Routes(method) {
+				route.Host = host
+				route.Middleware = table.middleware[route.entry]
+				routes = append(routes, route)
+			}
+		}
 	}
 	sort.Slice(routes, func(i, j int) bool {
 		if routes[i].Method != routes[j].Method {
 			return methodSort[routes[i].Method] < methodSort[routes[j].Method]
 		}
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
 		return routes[i].Route < routes[j].Route
 	})
 	return routes
 }
 
-// Match a route from a method and path
+// Match a route from a method and path. HEAD requests fall back to GET routes
+// when there's no explicit HEAD route.
 func (rt *Router) Match(method, path string) (*Match, error) {
-	tree, ok := rt.methods[method]
+	match, err := matchMethods(rt.registry.load().hosts.methods[rt.host], method, path)
+	if err != nil {
+		return nil, err
+	}
+	// Copy the match, since it may be shared
+	m := *match
+	m.Host = rt.host
+	m.static = false
+	return &m, nil
+}
+
+// matchMethods matches a route within the method trees
+func matchMethods(methods map[string]*tree, method, path string) (*Match, error) {
+	tree, ok := methods[method]
 	if !ok {
+		if method == http.MethodHead {
+			return matchMethods(methods, http.MethodGet, path)
+		}
 		return nil, fmt.Errorf("router: %w found for %s %s", ErrNoMatch, method, path)
 	}
-	return tree.Match(method, path)
+	match, err := tree.Match(method, path)
+	if err != nil && method == http.MethodHead && errors.Is(err, ErrNoMatch) {
+		return matchMethods(methods, http.MethodGet, path)
+	}
+	return match, err
 }
 
-// Insert the route into the method's radix tree
-func (rt *Router) insert(method, route string, handler http.Handler) error {
-	tr := rt.methods[method]
-	if tr == nil {
-		tr = &tree{
-			Tree:     enroute.New(),
-			Handlers: map[string]http.Handler{},
+// allow returns the sorted list of methods that have a route matching path. The
+// asterisk path (e.g. OPTIONS *) matches every method with a route.
+func allow(trees map[string]*tree, path string) (methods []string) {
+	for method, tree := range trees {
+		if path == "*" {
+			methods = append(methods, method)
+			continue
+		}
+		if _, err := tree.Match(method, path); err == nil {
+			methods = append(methods, method)
 		}
-		rt.methods[method] = tr
 	}
-	return tr.Insert(route, handler)
+	if len(methods) == 0 {
+		return nil
+	}
+	// GET routes also respond to HEAD requests
+	if slices.Contains(methods, http.MethodGet) && !slices.Contains(methods, http.MethodHead) {
+		methods = append(methods, http.MethodHead)
+	}
+	// OPTIONS requests are answered automatically
+	if !slices.Contains(methods, http.MethodOptions) {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methodSort[methods[i]] < methodSort[methods[j]]
+	})
+	return methods
+}
+
+// owner returns the router or group that registered the first route matching
+// the path within the allowed methods
+func owner(trees map[string]*tree, allow []string, path string) (*Router, bool) {
+	for _, method := range allow {
+		tree, ok := trees[method]
+		if !ok {
+			continue
+		}
+		if match, err := tree.Match(method, path); err == nil {
+			return match.router, true
+		}
+	}
+	return nil, false
+}
+
+// internalError is the default internal error function
+func internalError(w http.ResponseWriter, r *http.Request, err error) {
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// writeError is the default error handler. Client errors include the error
+// message, while server errors only include the status text.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		problem.ServeHTTP(w, r)
+		return
+	}
+	status := StatusOf(err)
+	if status >= http.StatusInternalServerError {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// noContent responds to automatic OPTIONS requests
+func noContent(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// methodNotAllowed is the default method not allowed handler
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+}
+
+// notAcceptable is the default not acceptable handler
+func notAcceptable(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "406 not acceptable", http.StatusNotAcceptable)
 }
 
 // isMethod returns true if method is a valid HTTP method
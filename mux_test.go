@@ -1,25 +1,43 @@
 package mux_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
 	"net/http/httputil"
+	"net/textproto"
 	"net/url"
+	"os"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/livebud/mux"
 	"github.com/matryer/is"
 	"github.com/matthewmueller/diff"
 )
 
-// Handler returns the raw query
+// Handler returns the query with the matched slots applied
 func handler(route string) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(route + " " + r.URL.RawQuery))
+		query := r.URL.Query()
+		if match, ok := mux.MatchFrom(r.Context()); ok {
+			for _, slot := range match.Slots {
+				query.Set(slot.Key, r.PathValue(slot.Key))
+			}
+		}
+		w.Write([]byte(route + " " + query.Encode()))
 	})
 }
 
@@ -35,6 +53,9 @@ func requestEqual(t testing.TB, router http.Handler, request string, expect stri
 	}
 	req := httptest.NewRequest(parts[0], u.Path, nil)
 	req.URL.RawQuery = u.RawQuery
+	if u.Host != "" {
+		req.Host = u.Host
+	}
 	rec := httptest.NewRecorder()
 	router.ServeHTTP(rec, req)
 	actual, err := httputil.DumpResponse(rec.Result(), true)
@@ -615,12 +636,13 @@ func TestSet(t *testing.T) {
 	router := mux.New()
 	router.Set(http.MethodHead, "/{id}", handler("HEAD /{id}"))
 	requestEqual(t, router, "GET /10", `
-		HTTP/1.1 404 Not Found
+		HTTP/1.1 405 Method Not Allowed
 		Connection: close
+		Allow: HEAD, OPTIONS
 		Content-Type: text/plain; charset=utf-8
 		X-Content-Type-Options: nosniff
 
-		404 page not found
+		405 method not allowed
 	`)
 	requestEqual(t, router, "HEAD /10", `
 		HTTP/1.1 200 OK
@@ -920,7 +942,7 @@ func TestMiddlewareWrapsNonMatches(t *testing.T) {
 		})
 	}))
 	router.Get("/", handler("GET /"))
-	requestEqual(t, router, "POST /", `
+	requestEqual(t, router, "GET /missing", `
 			HTTP/1.1 404 Not Found
 			Connection: close
 			Content-Type: text/plain; charset=utf-8
@@ -929,6 +951,16 @@ func TestMiddlewareWrapsNonMatches(t *testing.T) {
 
 			404 page not found
 	`)
+	requestEqual(t, router, "POST /", `
+			HTTP/1.1 405 Method Not Allowed
+			Connection: close
+			Allow: GET, HEAD, OPTIONS
+			Content-Type: text/plain; charset=utf-8
+			X-A: A
+			X-Content-Type-Options: nosniff
+
+			405 method not allowed
+	`)
 }
 
 func TestPostBody(t *testing.T) {
@@ -1106,3 +1138,2590 @@ func TestMount(t *testing.T) {
 		GET /telegram/commands
 	`)
 }
+
+func TestMethodNotAllowed(t *testing.T) {
+	router := mux.New()
+	router.Get("/users/{id}", handler("GET /users/{id}"))
+	router.Delete("/users/{id}", handler("DELETE /users/{id}"))
+	router.Patch("/users/{id}", handler("PATCH /users/{id}"))
+	router.Post("/users", handler("POST /users"))
+	requestEqual(t, router, "POST /users/10", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: GET, HEAD, PATCH, DELETE, OPTIONS
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		405 method not allowed
+	`)
+	requestEqual(t, router, "GET /users", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: POST, OPTIONS
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		405 method not allowed
+	`)
+	requestEqual(t, router, "GET /posts", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		404 page not found
+	`)
+}
+
+func TestCustomNotFound(t *testing.T) {
+	router := mux.New(
+		mux.NotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("no route for " + r.URL.Path))
+		})),
+		mux.MethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte(r.Method + " only supports " + w.Header().Get("Allow")))
+		})),
+	)
+	router.Get("/", handler("GET /"))
+	router.Post("/", handler("POST /"))
+	requestEqual(t, router, "GET /missing", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+
+		no route for /missing
+	`)
+	requestEqual(t, router, "DELETE /", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: GET, HEAD, POST, OPTIONS
+
+		DELETE only supports GET, HEAD, POST, OPTIONS
+	`)
+}
+
+func TestMiddlewareMethodNotAllowed(t *testing.T) {
+	router := mux.New()
+	router.Get("/", handler("GET /"))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next"))
+	})
+	handler := router.Middleware(next)
+	requestEqual(t, handler, "GET /missing", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		next
+	`)
+	requestEqual(t, handler, "POST /", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: GET, HEAD, OPTIONS
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		405 method not allowed
+	`)
+}
+
+func TestHeadFallback(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Get("/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Id", r.PathValue("id"))
+		w.Write([]byte("user " + r.PathValue("id")))
+	}))
+	req := httptest.NewRequest(http.MethodHead, "/users/10", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Header().Get("X-Id"), "10")
+	is.Equal(rec.Header().Get("Content-Length"), "7")
+	is.Equal(rec.Header().Get("Content-Type"), "text/plain; charset=utf-8")
+	is.Equal(rec.Body.Len(), 0)
+
+	// Matching also falls back
+	match, err := router.Match(http.MethodHead, "/users/10")
+	is.NoErr(err)
+	is.Equal(match.Method, http.MethodGet)
+	is.Equal(match.Route, "/users/{id}")
+}
+
+func TestHeadStatus(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Get("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("accepted"))
+	}))
+	req := httptest.NewRequest(http.MethodHead, "/", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusAccepted)
+	is.Equal(rec.Header().Get("Content-Length"), "100")
+	is.Equal(rec.Body.Len(), 0)
+}
+
+func TestHeadFlush(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Get("/events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("data: 1\n\n"))
+		flusher.Flush()
+		w.Write([]byte("data: 2\n\n"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	var logs bytes.Buffer
+	server := httptest.NewUnstartedServer(router)
+	server.Config.ErrorLog = log.New(&logs, "", 0)
+	server.Start()
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodHead, server.URL+"/events", nil)
+	is.NoErr(err)
+	res, err := http.DefaultClient.Do(req)
+	is.NoErr(err)
+	res.Body.Close()
+	is.Equal(res.StatusCode, http.StatusOK)
+	// Flushing sends the headers before the length is known
+	is.Equal(res.Header.Get("Content-Length"), "")
+	is.Equal(res.Header.Get("Content-Type"), "text/plain; charset=utf-8")
+	server.Close()
+	is.Equal(logs.String(), "")
+}
+
+func TestHeadFlushBlocking(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	done := make(chan struct{})
+	router.Get("/events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		// Stream until the client or the test is done
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+	defer close(done)
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		req, err := http.NewRequest(method, server.URL+"/events", nil)
+		is.NoErr(err)
+		res, err := client.Do(req)
+		is.NoErr(err) // headers arrive before the handler returns
+		is.Equal(res.StatusCode, http.StatusOK)
+		is.Equal(res.Header.Get("Content-Type"), "text/event-stream")
+		is.Equal(res.Header.Get("Content-Length"), "")
+		res.Body.Close()
+	}
+}
+
+func TestHeadEarlyHints(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Get("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</app.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("accepted"))
+	}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+	var informational []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			informational = append(informational, code)
+			return nil
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodHead, server.URL, nil)
+	is.NoErr(err)
+	res, err := http.DefaultClient.Do(req)
+	is.NoErr(err)
+	res.Body.Close()
+	is.Equal(informational, []int{http.StatusEarlyHints})
+	is.Equal(res.StatusCode, http.StatusAccepted)
+	is.Equal(res.Header.Get("Content-Length"), "8")
+}
+
+func TestHeadExplicit(t *testing.T) {
+	router := mux.New()
+	router.Get("/{id}", handler("GET /{id}"))
+	router.Set(http.MethodHead, "/{id}", handler("HEAD /{id}"))
+	requestEqual(t, router, "HEAD /10", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		HEAD /{id} id=10
+	`)
+	router.Post("/", handler("POST /"))
+	requestEqual(t, router, "HEAD /", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: POST, OPTIONS
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		405 method not allowed
+	`)
+}
+
+func TestOptions(t *testing.T) {
+	router := mux.New()
+	router.Get("/users/{id}", handler("GET /users/{id}"))
+	router.Delete("/users/{id}", handler("DELETE /users/{id}"))
+	router.Post("/users", handler("POST /users"))
+	requestEqual(t, router, "OPTIONS /users/10", `
+		HTTP/1.1 204 No Content
+		Connection: close
+		Allow: GET, HEAD, DELETE, OPTIONS
+	`)
+	requestEqual(t, router, "OPTIONS /users", `
+		HTTP/1.1 204 No Content
+		Connection: close
+		Allow: POST, OPTIONS
+	`)
+	requestEqual(t, router, "OPTIONS *", `
+		HTTP/1.1 204 No Content
+		Connection: close
+		Allow: GET, HEAD, POST, DELETE, OPTIONS
+	`)
+	requestEqual(t, router, "OPTIONS /posts", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		404 page not found
+	`)
+}
+
+func TestOptionsExplicit(t *testing.T) {
+	router := mux.New()
+	router.Get("/users", handler("GET /users"))
+	router.Set(http.MethodOptions, "/users", handler("OPTIONS /users"))
+	requestEqual(t, router, "OPTIONS /users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		OPTIONS /users
+	`)
+}
+
+func TestPathValue(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Get("/users/{id}.{format?}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		match, ok := mux.MatchFrom(r.Context())
+		is.True(ok)
+		is.Equal(match.Route, "/users/{id}.{format?}")
+		is.Equal(r.Pattern, "GET /users/{id}.{format?}")
+		w.Write([]byte(r.PathValue("id") + " " + r.PathValue("format") + " " + r.URL.RawQuery))
+	}))
+	requestEqual(t, router, "GET /users/10.json?id=20&b=2&a=1", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		10 json id=20&b=2&a=1
+	`)
+}
+
+func TestMatchFromMissing(t *testing.T) {
+	is := is.New(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	match, ok := mux.MatchFrom(req.Context())
+	is.True(!ok)
+	is.Equal(match, nil)
+}
+
+func TestQuerySlots(t *testing.T) {
+	router := mux.New(mux.QuerySlots())
+	router.Get("/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("id") + " " + r.URL.RawQuery))
+	}))
+	requestEqual(t, router, "GET /users/10?id=20&b=2&a=1", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		10 a=1&b=2&id=10
+	`)
+}
+
+// header middleware sets a response header
+func header(key, value string) mux.Middleware {
+	return mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add(key, value)
+			next.ServeHTTP(w, r)
+		})
+	})
+}
+
+func TestGroupMiddleware(t *testing.T) {
+	router := mux.New()
+	router.Use(header("X-Root", "root"))
+	router.Get("/", handler("GET /"))
+	api := router.Group("/api")
+	api.Use(header("X-Api", "api"))
+	api.Get("/users", handler("GET /api/users"))
+	v1 := api.Group("/v1")
+	v1.Use(header("X-Order", "v1"))
+	v1.Get("/users", handler("GET /api/v1/users"))
+	admin := router.Group("/admin")
+	admin.Use(header("X-Admin", "admin"))
+	admin.Get("/", handler("GET /admin"))
+	// Middleware added after routes are registered still applies
+	api.Use(header("X-Order", "api"))
+
+	requestEqual(t, router, "GET /", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Root: root
+
+		GET /
+	`)
+	requestEqual(t, router, "GET /api/users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Api: api
+		X-Order: api
+		X-Root: root
+
+		GET /api/users
+	`)
+	requestEqual(t, router, "GET /api/v1/users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Api: api
+		X-Order: api
+		X-Order: v1
+		X-Root: root
+
+		GET /api/v1/users
+	`)
+	requestEqual(t, router, "GET /admin", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Admin: admin
+		X-Root: root
+
+		GET /admin
+	`)
+	requestEqual(t, router, "GET /api/missing", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+		X-Root: root
+
+		404 page not found
+	`)
+	requestEqual(t, router, "OPTIONS /api/users", `
+		HTTP/1.1 204 No Content
+		Connection: close
+		Allow: GET, HEAD, OPTIONS
+		X-Api: api
+		X-Order: api
+		X-Root: root
+	`)
+}
+
+func TestGroupMiddlewareAliasing(t *testing.T) {
+	router := mux.New()
+	router.Use(header("X-Root", "1"))
+	router.Use(header("X-Root", "2"))
+	a := router.Group("/a")
+	b := router.Group("/b")
+	a.Use(header("X-Group", "a"))
+	b.Use(header("X-Group", "b"))
+	a.Get("/", handler("GET /a"))
+	b.Get("/", handler("GET /b"))
+	requestEqual(t, router, "GET /a", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Group: a
+		X-Root: 1
+		X-Root: 2
+
+		GET /a
+	`)
+	requestEqual(t, router, "GET /b", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Group: b
+		X-Root: 1
+		X-Root: 2
+
+		GET /b
+	`)
+}
+
+type adminHandler struct {
+}
+
+var _ mux.Mountable = (*adminHandler)(nil)
+
+func (a *adminHandler) Mount(routes mux.Routes) {
+	routes.Use(header("X-Admin", "admin"))
+	routes.Get("/admin", handler("GET /admin"))
+}
+
+func TestMountMiddleware(t *testing.T) {
+	router := mux.New()
+	router.Get("/", handler("GET /"))
+	router.Mount(&adminHandler{})
+	router.Group("/slack").Mount(&slackHandler{})
+	requestEqual(t, router, "GET /admin", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Admin: admin
+
+		GET /admin
+	`)
+	requestEqual(t, router, "GET /", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /
+	`)
+	requestEqual(t, router, "GET /slack/commands", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /slack/commands
+	`)
+}
+
+func TestGroupServeHTTP(t *testing.T) {
+	router := mux.New()
+	router.Use(header("X-Root", "root"))
+	api := router.Group("/api")
+	api.Use(header("X-Api", "api"))
+	api.Get("/users", handler("GET /api/users"))
+	requestEqual(t, api, "GET /api/users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Api: api
+		X-Root: root
+
+		GET /api/users
+	`)
+}
+
+func TestURL(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Name("home").Get("/", handler("GET /")))
+	is.NoErr(router.Name("user.show").Get("/users/{id}.{format?}", handler("GET /users/{id}.{format?}")))
+	is.NoErr(router.Name("user.show").Patch("/users/{id}.{format?}", handler("PATCH /users/{id}.{format?}")))
+	is.NoErr(router.Name("version").Get("/v{major|[0-9]+}.{minor|[0-9]+}", handler("GET /v{major}.{minor}")))
+	is.NoErr(router.Name("file").Get("/{owner}/{repo}/{branch}/{path*}", handler("GET /{owner}/{repo}/{branch}/{path*}")))
+	is.NoErr(router.Name("fly").Get("/fly/{from}-{to}", handler("GET /fly/{from}-{to}")))
+	is.NoErr(router.Group("/posts/{post_id}").Name("comment.show").Get("/comments/{id}", handler("GET /posts/{post_id}/comments/{id}")))
+
+	url, err := router.URL("home")
+	is.NoErr(err)
+	is.Equal(url, "/")
+	url, err = router.URL("user.show", "id", "10")
+	is.NoErr(err)
+	is.Equal(url, "/users/10")
+	url, err = router.URL("user.show", "id", "10", "format", "json")
+	is.NoErr(err)
+	is.Equal(url, "/users/10.json")
+	url, err = router.URL("user.show", "id", "a b")
+	is.NoErr(err)
+	is.Equal(url, "/users/a%20b")
+	url, err = router.Build("version", map[string]string{"major": "1", "minor": "20"})
+	is.NoErr(err)
+	is.Equal(url, "/v1.20")
+	url, err = router.URL("file", "owner", "livebud", "repo", "mux", "branch", "main", "path", "path/to/file name.go")
+	is.NoErr(err)
+	is.Equal(url, "/livebud/mux/main/path/to/file%20name.go")
+	url, err = router.URL("file", "owner", "livebud", "repo", "mux", "branch", "main")
+	is.NoErr(err)
+	is.Equal(url, "/livebud/mux/main")
+	url, err = router.URL("fly", "from", "sfo", "to", "lax")
+	is.NoErr(err)
+	is.Equal(url, "/fly/sfo-lax")
+	url, err = router.URL("comment.show", "post_id", "1", "id", "2")
+	is.NoErr(err)
+	is.Equal(url, "/posts/1/comments/2")
+
+	// Built URLs match their routes
+	match, err := router.Match(http.MethodGet, "/v1.20")
+	is.NoErr(err)
+	is.Equal(match.Route, "/v{major|^[0-9]+$}.{minor|^[0-9]+$}")
+
+	// Errors
+	url, err = router.URL("user.show")
+	is.Equal(url, "")
+	missing := new(mux.MissingSlotError)
+	is.True(errors.As(err, &missing))
+	is.Equal(missing.Slot, "id")
+	_, err = router.URL("version", "major", "v1", "minor", "0")
+	invalid := new(mux.InvalidSlotError)
+	is.True(errors.As(err, &invalid))
+	is.Equal(invalid.Slot, "major")
+	is.Equal(invalid.Value, "v1")
+	_, err = router.URL("user.show", "id")
+	is.True(err != nil)
+	_, err = router.URL("unknown")
+	is.True(errors.Is(err, mux.ErrNoMatch))
+}
+
+func TestNameRoutes(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/", handler("GET /")))
+	is.NoErr(router.Name("user").Get("/users/{id}", handler("GET /users/{id}")))
+	err := router.Name("user").Get("/people/{id}", handler("GET /people/{id}"))
+	is.True(errors.Is(err, mux.ErrDuplicate))
+	_, err = router.Find(http.MethodGet, "/people/{id}")
+	is.True(errors.Is(err, mux.ErrNoMatch))
+	routes := router.Routes()
+	is.Equal(len(routes), 2)
+	is.Equal(routes[0].Name, "")
+	is.Equal(routes[1].Name, "user")
+	route, err := router.Find(http.MethodGet, "/users/{id}")
+	is.NoErr(err)
+	is.Equal(route.Name, "user")
+}
+
+func TestHost(t *testing.T) {
+	router := mux.New()
+	router.Get("/", handler("GET /"))
+	router.Get("/users/{id}", handler("GET /users/{id}"))
+	tenant := router.Host("{tenant}.example.com")
+	tenant.Get("/", handler("GET {tenant}.example.com/"))
+	tenant.Post("/users", handler("POST {tenant}.example.com/users"))
+	api := router.Host("api.example.com")
+	api.Get("/", handler("GET api.example.com/"))
+
+	requestEqual(t, router, "GET http://acme.example.com/", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET {tenant}.example.com/ tenant=acme
+	`)
+	requestEqual(t, router, "GET http://ACME.example.com:3000/", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET {tenant}.example.com/ tenant=acme
+	`)
+	requestEqual(t, router, "GET http://api.example.com/", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET api.example.com/
+	`)
+	requestEqual(t, router, "GET http://example.com/", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /
+	`)
+	// Falls back to routes without a host
+	requestEqual(t, router, "GET http://acme.example.com/users/10", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users/{id} id=10
+	`)
+	requestEqual(t, router, "POST http://acme.example.com/users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		POST {tenant}.example.com/users tenant=acme
+	`)
+	requestEqual(t, router, "POST http://example.com/users", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		404 page not found
+	`)
+	requestEqual(t, router, "DELETE http://acme.example.com/users", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: POST, OPTIONS
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		405 method not allowed
+	`)
+}
+
+func TestHostSlots(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Host("{tenant}.example.com").Get("/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		match, ok := mux.MatchFrom(r.Context())
+		is.True(ok)
+		is.Equal(match.Host, "{tenant}.example.com")
+		is.Equal(match.Route, "/users/{id}")
+		is.Equal(len(match.Slots), 2)
+		w.Write([]byte(r.PathValue("tenant") + " " + r.PathValue("id")))
+	}))
+	requestEqual(t, router, "GET http://acme.example.com/users/10", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		acme 10
+	`)
+}
+
+func TestHostRoutes(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/", handler("GET /")))
+	is.NoErr(router.Host("{tenant}.example.com").Get("/", handler("GET {tenant}.example.com/")))
+	is.NoErr(router.Host("api.example.com").Group("/v1").Get("/users", handler("GET api.example.com/v1/users")))
+	routes := router.Routes()
+	is.Equal(len(routes), 3)
+	is.Equal(routes[0].String(), "GET /")
+	is.Equal(routes[1].String(), "GET api.example.com/v1/users")
+	is.Equal(routes[2].String(), "GET {tenant}.example.com/")
+	is.Equal(routes[2].Host, "{tenant}.example.com")
+	err := router.Host("localhost:3000").Get("/", handler("GET localhost/"))
+	is.NoErr(err)
+	err = router.Host("{a}{b}.com").Get("/", handler("GET {a}{b}.com/"))
+	is.True(err != nil)
+}
+
+func TestRouteMatchers(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Route("GET", "/search").Query("q", "{q}").Header("X-Api-Version", "2").Handler(handler("GET /search v2")))
+	is.NoErr(router.Route("GET", "/search").Query("q", "{q}").Handler(handler("GET /search")))
+	is.NoErr(router.Route("GET", "/search").Query("page", "{page|[0-9]+}").Handler(handler("GET /search paged")))
+	is.NoErr(router.Get("/search", handler("GET /search default")))
+	requestEqual(t, router, "GET /search?q=mux", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /search q=mux
+	`)
+	requestEqual(t, router, "GET /search?page=2", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /search paged page=2
+	`)
+	requestEqual(t, router, "GET /search?page=two", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /search default page=two
+	`)
+	requestEqual(t, router, "GET /search", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /search default 
+	`)
+
+	req := httptest.NewRequest(http.MethodGet, "/search?q=mux", nil)
+	req.Header.Set("X-Api-Version", "2")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Body.String(), "GET /search v2 q=mux")
+
+	// Duplicates
+	err := router.Route("GET", "/search").Query("q", "{q}").Handler(handler("GET /search"))
+	is.True(errors.Is(err, mux.ErrDuplicate))
+	err = router.Get("/search", handler("GET /search default"))
+	is.True(errors.Is(err, mux.ErrDuplicate))
+
+	routes := router.Routes()
+	is.Equal(len(routes), 4)
+	is.Equal(routes[0].Matchers, []string{"query q={q}", "header X-Api-Version=2"})
+	is.Equal(routes[1].Matchers, []string{"query q={q}"})
+	is.Equal(routes[2].Matchers, []string{"query page={page|[0-9]+}"})
+	is.Equal(routes[3].Matchers, nil)
+}
+
+func TestRouteMatchersNoFallback(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Route("GET", "/").Scheme("https").Handler(handler("GET https /")))
+	is.NoErr(router.Route("GET", "/users/{id}").Header("Accept-Version", "v1").Handler(handler("GET /users/{id} v1")))
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Body.String(), "GET https / ")
+	requestEqual(t, router, "GET /users/10", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		404 page not found
+	`)
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNotFound)
+	req = httptest.NewRequest(http.MethodGet, "/users/10", nil)
+	req.Header.Set("Accept-Version", "v1")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Body.String(), "GET /users/{id} v1 id=10")
+}
+
+func TestRouteBuilderErrors(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	err := router.Route("GET", "/").Query("q", "{|a}").Handler(handler("GET /"))
+	is.True(err != nil)
+	err = router.Route("GET", "/").Query("q", "{q|[}").Handler(handler("GET /"))
+	is.True(err != nil)
+	err = router.Route("get", "/").Handler(handler("GET /"))
+	is.True(err != nil)
+	is.NoErr(router.Group("/api").Route("GET", "/users").Name("users").Header("X-Api-Version", "2").Handler(handler("GET /api/users")))
+	url, err := router.URL("users")
+	is.NoErr(err)
+	is.Equal(url, "/api/users")
+}
+
+func negotiate(t testing.TB, router http.Handler, path, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNegotiate(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	mediaType := func(w http.ResponseWriter, r *http.Request) {
+		match, _ := mux.MatchFrom(r.Context())
+		w.Write([]byte(match.MediaType + " " + r.PathValue("id")))
+	}
+	for _, route := range []string{"/users/{id}", "/users/{id}.{format}"} {
+		is.NoErr(router.Route("GET", route).Accept("text/html").Handler(http.HandlerFunc(mediaType)))
+		is.NoErr(router.Route("GET", route).Accept("application/json", "application/xml").Handler(http.HandlerFunc(mediaType)))
+	}
+
+	rec := negotiate(t, router, "/users/10", "")
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Body.String(), "text/html 10")
+	is.Equal(rec.Header().Get("Vary"), "Accept")
+	rec = negotiate(t, router, "/users/10", "application/json")
+	is.Equal(rec.Body.String(), "application/json 10")
+	rec = negotiate(t, router, "/users/10", "text/html;q=0.5, application/*;q=0.8")
+	is.Equal(rec.Body.String(), "application/json 10")
+	rec = negotiate(t, router, "/users/10", "text/html;q=0.5, application/json;q=0.1, application/xml")
+	is.Equal(rec.Body.String(), "application/xml 10")
+	rec = negotiate(t, router, "/users/10", "text/*, application/json;q=0")
+	is.Equal(rec.Body.String(), "text/html 10")
+	rec = negotiate(t, router, "/users/10", "application/json;q=0, */*;q=0.1")
+	is.Equal(rec.Body.String(), "text/html 10")
+
+	// Extension takes precedence
+	rec = negotiate(t, router, "/users/10.json", "text/html")
+	is.Equal(rec.Body.String(), "application/json 10")
+	rec = negotiate(t, router, "/users/10.html", "")
+	is.Equal(rec.Body.String(), "text/html 10")
+
+	// Not acceptable
+	rec = negotiate(t, router, "/users/10", "image/png")
+	is.Equal(rec.Code, http.StatusNotAcceptable)
+	is.Equal(rec.Header().Get("Vary"), "Accept")
+	is.Equal(rec.Body.String(), "406 not acceptable\n")
+	rec = negotiate(t, router, "/users/10.png", "")
+	is.Equal(rec.Code, http.StatusNotAcceptable)
+	rec = negotiate(t, router, "/users/10", "application/json;q=0")
+	is.Equal(rec.Code, http.StatusNotAcceptable)
+
+	routes := router.Routes()
+	is.Equal(routes[0].Matchers, []string{"accept text/html"})
+	is.Equal(routes[1].Matchers, []string{"accept application/json, application/xml"})
+}
+
+func TestNegotiateFallback(t *testing.T) {
+	is := is.New(t)
+	router := mux.New(mux.NotAcceptable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotAcceptable)
+		w.Write([]byte("custom"))
+	})))
+	is.NoErr(router.Route("GET", "/").Accept("application/json").Handler(handler("GET / json")))
+	is.NoErr(router.Get("/", handler("GET /")))
+	is.NoErr(router.Route("GET", "/users").Accept("application/json").Handler(handler("GET /users json")))
+	rec := negotiate(t, router, "/", "application/json")
+	is.Equal(rec.Body.String(), "GET / json ")
+	rec = negotiate(t, router, "/", "text/html")
+	is.Equal(rec.Body.String(), "GET / ")
+	is.Equal(rec.Header().Get("Vary"), "Accept")
+	rec = negotiate(t, router, "/users", "text/html")
+	is.Equal(rec.Code, http.StatusNotAcceptable)
+	is.Equal(rec.Body.String(), "custom")
+	err := router.Route("GET", "/").Accept("application/json").Handler(handler("GET / json"))
+	is.True(errors.Is(err, mux.ErrDuplicate))
+	err = router.Route("GET", "/").Accept("application/json;").Handler(handler("GET / json"))
+	is.True(err != nil)
+}
+
+func TestRemove(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/users/{id}", handler("GET /users/{id}")))
+	is.NoErr(router.Name("user").Post("/users/{id}", handler("POST /users/{id}")))
+	is.NoErr(router.Route(http.MethodGet, "/users/{id}").Header("X-Api-Version", "2").Handler(handler("GET /users/{id} v2")))
+	requestEqual(t, router, "GET /users/10", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users/{id} id=10
+	`)
+	is.NoErr(router.Remove(http.MethodGet, "/users/{user_id}"))
+	requestEqual(t, router, "GET /users/10", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: POST, OPTIONS
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		405 method not allowed
+	`)
+	is.Equal(len(router.Routes()), 1)
+	err := router.Remove(http.MethodGet, "/users/{id}")
+	is.True(errors.Is(err, mux.ErrNoMatch))
+	// Removing a named route frees the name
+	is.NoErr(router.Remove(http.MethodPost, "/users/{id}"))
+	is.NoErr(router.Name("user").Get("/people/{id}", handler("GET /people/{id}")))
+	requestEqual(t, router, "GET /users/10", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		404 page not found
+	`)
+}
+
+func TestRemoveGroup(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/users", handler("GET /users")))
+	api := router.Group("/api")
+	is.NoErr(api.Get("/users", handler("GET /api/users")))
+	is.NoErr(api.Remove(http.MethodGet, "/users"))
+	requestEqual(t, router, "GET /users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users 
+	`)
+	requestEqual(t, router, "GET /api/users", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		404 page not found
+	`)
+	err := router.Host("example.com").Remove(http.MethodGet, "/users")
+	is.True(errors.Is(err, mux.ErrNoMatch))
+}
+
+func TestReplace(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Replace(http.MethodGet, "/users/{id}", handler("GET /users/{id} v1")))
+	requestEqual(t, router, "GET /users/10", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users/{id} v1 id=10
+	`)
+	is.NoErr(router.Replace(http.MethodGet, "/users/{user_id}", handler("GET /users/{user_id} v2")))
+	requestEqual(t, router, "GET /users/10", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users/{user_id} v2 user_id=10
+	`)
+	is.Equal(len(router.Routes()), 1)
+	err := router.Replace("FETCH", "/users/{id}", handler("FETCH /users/{id}"))
+	is.True(err != nil)
+}
+
+func TestReplaceOrder(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/files/{name}", handler("GET /files/{name}")))
+	is.NoErr(router.Get("/files/{path*}", handler("GET /files/{path*}")))
+	is.NoErr(router.Get("/files/{name}/raw", handler("GET /files/{name}/raw")))
+	paths := []string{"/files/x", "/files/x/y", "/files/x/raw"}
+	var before []string
+	for _, path := range paths {
+		_, body := serveRequest(router, http.MethodGet, path)
+		before = append(before, body)
+	}
+	is.Equal(before[0], "GET /files/{name} name=x")
+	// Replacing a route keeps its place, so other paths route the same way
+	is.NoErr(router.Replace(http.MethodGet, "/files/{name}", handler("GET /files/{name} v2")))
+	_, body := serveRequest(router, http.MethodGet, "/files/x")
+	is.Equal(body, "GET /files/{name} v2 name=x")
+	for i, path := range paths[1:] {
+		_, body := serveRequest(router, http.MethodGet, path)
+		is.Equal(body, before[i+1])
+	}
+	is.Equal(router.Routes()[0].Route, "/files/{name}")
+}
+
+func TestBatch(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Route(http.MethodGet, "/users").Header("X-Api-Version", "2").Handler(handler("GET /users v2")))
+	is.NoErr(router.Get("/users/{id}", handler("GET /users/{id}")))
+	// A failing batch registers none of its routes
+	err := router.Batch(func(batch *mux.Router) error {
+		is.NoErr(batch.Get("/users", handler("GET /users")))
+		is.NoErr(batch.Name("posts").Get("/posts", handler("GET /posts")))
+		return batch.Get("/users/{user_id}", handler("GET /users/{user_id}"))
+	})
+	is.True(errors.Is(err, mux.ErrDuplicate))
+	is.Equal(len(router.Routes()), 2)
+	_, err = router.URL("posts")
+	is.True(err != nil)
+	status, _ := serveRequest(router, http.MethodGet, "/users")
+	is.Equal(status, http.StatusNotFound)
+	status, _ = serveRequest(router, http.MethodGet, "/posts")
+	is.Equal(status, http.StatusNotFound)
+	// Routes are registered once the batch succeeds
+	err = router.Batch(func(batch *mux.Router) error {
+		is.NoErr(batch.Get("/users", handler("GET /users")))
+		is.NoErr(batch.Group("/api").Get("/posts", handler("GET /api/posts")))
+		status, _ := serveRequest(router, http.MethodGet, "/users")
+		is.Equal(status, http.StatusNotFound)
+		is.True(batch.Remove(http.MethodGet, "/users/{id}") != nil)
+		is.True(batch.Replace(http.MethodGet, "/users", handler("GET /users")) != nil)
+		return nil
+	})
+	is.NoErr(err)
+	is.Equal(len(router.Routes()), 4)
+	status, body := serveRequest(router, http.MethodGet, "/users")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "GET /users ")
+	status, body = serveRequest(router, http.MethodGet, "/api/posts")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "GET /api/posts ")
+	// Errors from the function cancel the batch
+	err = router.Batch(func(batch *mux.Router) error {
+		is.NoErr(batch.Get("/comments", handler("GET /comments")))
+		return errors.New("canceled")
+	})
+	is.Equal(err.Error(), "canceled")
+	is.Equal(len(router.Routes()), 4)
+}
+
+func TestConcurrentRegistration(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/", handler("GET /")))
+	api := router.Group("/api")
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				route := fmt.Sprintf("/{id}/%d/%d", i, j)
+				if err := api.Get(route, handler("GET "+route)); err != nil {
+					t.Error(err)
+					return
+				}
+				if j%2 == 0 {
+					if err := api.Remove(http.MethodGet, route); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+				if err := api.Replace(http.MethodPost, route, handler("POST "+route)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rec.Code != http.StatusOK {
+					t.Errorf("unexpected status %d", rec.Code)
+					return
+				}
+				rec = httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/10/0/1", nil))
+				router.Routes()
+			}
+		}()
+	}
+	wg.Wait()
+	is.Equal(len(router.Routes()), 1+4*25+4*50)
+	requestEqual(t, router, "GET /api/10/3/49", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /{id}/3/49 id=10
+	`)
+}
+
+func TestUseAfterServe(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	api := router.Group("/api")
+	is.NoErr(api.Get("/users", handler("GET /api/users")))
+	requestEqual(t, router, "GET /api/users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /api/users 
+	`)
+	router.Use(header("X-Router", "1"))
+	api.Use(header("X-Api", "1"))
+	requestEqual(t, router, "GET /api/users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Api: 1
+		X-Router: 1
+
+		GET /api/users 
+	`)
+}
+
+func TestConcurrentUse(t *testing.T) {
+	router := mux.New()
+	api := router.Group("/api")
+	api.Get("/users", http.HandlerFunc(noop))
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			api.Use(mux.Use(func(next http.Handler) http.Handler { return next }))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("unexpected status %d", rec.Code)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestMiddlewareAllocs(t *testing.T) {
+	is := is.New(t)
+	allocs := func(router *mux.Router, path string) float64 {
+		w := &discard{header: http.Header{}}
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		return testing.AllocsPerRun(100, func() {
+			router.ServeHTTP(w, r)
+		})
+	}
+	plain := mux.New()
+	is.NoErr(plain.Get("/api/users", http.HandlerFunc(noop)))
+	is.NoErr(plain.Get("/api/users/{id}", http.HandlerFunc(noop)))
+	composed := mux.New()
+	composed.Use(mux.Use(func(next http.Handler) http.Handler { return next }))
+	api := composed.Group("/api")
+	api.Use(mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+		})
+	}))
+	api.UseRoute(mux.Use(func(next http.Handler) http.Handler { return next }))
+	is.NoErr(api.Get("/users", http.HandlerFunc(noop)))
+	is.NoErr(api.Get("/users/{id}", http.HandlerFunc(noop)))
+	// Middleware is composed once, so it doesn't allocate per request
+	is.Equal(allocs(composed, "/api/users"), allocs(plain, "/api/users"))
+	is.Equal(allocs(composed, "/api/users/10"), allocs(plain, "/api/users/10"))
+}
+
+func TestStaticAllocs(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Use(mux.Use(func(next http.Handler) http.Handler { return next }))
+	api := router.Group("/api")
+	api.Use(mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+		})
+	}))
+	var pattern string
+	is.NoErr(api.Get("/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pattern = r.Pattern
+	})))
+	is.NoErr(api.Get("/users/{id}", http.HandlerFunc(noop)))
+	w := &discard{header: http.Header{}}
+	r := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	allocs := testing.AllocsPerRun(100, func() {
+		router.ServeHTTP(w, r)
+	})
+	// Matching doesn't allocate. Storing the shared match for MatchFrom takes a
+	// context value and a copy of the request, which is why static routes
+	// don't reach zero allocations. See the Changelog.
+	is.Equal(allocs, 2.0)
+	is.Equal(pattern, "GET /api/users")
+}
+
+func TestStaticMatchFrom(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := mux.MatchFrom(r.Context())
+		w.Write([]byte(fmt.Sprintf("%s %t", r.Pattern, ok)))
+	})))
+	requestEqual(t, router, "GET /users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users true
+	`)
+	// Case and trailing slash differences fall back to the tree
+	requestEqual(t, router, "GET /Users/", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users true
+	`)
+	// Matches returned by Match are safe to modify
+	match, err := router.Match(http.MethodGet, "/users")
+	is.NoErr(err)
+	match.Route = "/changed"
+	match, err = router.Match(http.MethodGet, "/users")
+	is.NoErr(err)
+	is.Equal(match.Route, "/users")
+}
+
+func TestMatchFromAfterServe(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	served := make(chan struct{})
+	routes := make(chan string, 3)
+	record := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Keep using the request after the router returns
+		<-served
+		match, _ := mux.MatchFrom(r.Context())
+		routes <- match.Route + " " + r.PathValue("id")
+	})
+	is.NoErr(router.Get("/users", http.TimeoutHandler(record, time.Millisecond, "timeout")))
+	is.NoErr(router.Get("/users/{id}", http.TimeoutHandler(record, time.Millisecond, "timeout")))
+	status, _ := serveRequest(router, http.MethodGet, "/users/10")
+	is.Equal(status, http.StatusServiceUnavailable)
+	status, _ = serveRequest(router, http.MethodGet, "/users")
+	is.Equal(status, http.StatusServiceUnavailable)
+	// Serve another request that could reuse the matches
+	serveRequest(router, http.MethodGet, "/users/20")
+	close(served)
+	got := []string{<-routes, <-routes, <-routes}
+	slices.Sort(got)
+	is.Equal(got, []string{"/users ", "/users/{id} 10", "/users/{id} 20"})
+}
+
+// logger records the matched route pattern, or the path if nothing matched
+func logger(log *[]string) mux.Middleware {
+	return mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			line := r.Method + " " + r.URL.Path
+			if match, ok := mux.MatchFrom(r.Context()); ok {
+				line = match.Method + " " + match.Route
+			}
+			*log = append(*log, line)
+		})
+	})
+}
+
+func TestUseRoute(t *testing.T) {
+	is := is.New(t)
+	var before, after []string
+	router := mux.New()
+	router.Use(logger(&before))
+	router.UseRoute(logger(&after))
+	is.NoErr(router.Get("/users", handler("GET /users")))
+	is.NoErr(router.Get("/users/{id}", handler("GET /users/{id}")))
+	requestEqual(t, router, "GET /users/8812", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users/{id} id=8812
+	`)
+	requestEqual(t, router, "GET /users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users 
+	`)
+	requestEqual(t, router, "GET /posts", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		404 page not found
+	`)
+	is.Equal(before, []string{"GET /users/8812", "GET /users", "GET /posts"})
+	is.Equal(after, []string{"GET /users/{id}", "GET /users"})
+}
+
+func TestUseRouteOrder(t *testing.T) {
+	router := mux.New()
+	router.UseRoute(header("X-Order", "router route"))
+	router.Use(header("X-Order", "router"))
+	api := router.Group("/api")
+	api.UseRoute(header("X-Order", "api route"))
+	api.Use(header("X-Order", "api"))
+	api.Get("/users", handler("GET /api/users"))
+	requestEqual(t, router, "GET /api/users", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Order: router
+		X-Order: router route
+		X-Order: api
+		X-Order: api route
+
+		GET /api/users 
+	`)
+	// Automatic OPTIONS responses don't match a route
+	requestEqual(t, router, "OPTIONS /api/users", `
+		HTTP/1.1 204 No Content
+		Connection: close
+		Allow: GET, HEAD, OPTIONS
+		X-Order: router
+		X-Order: api
+	`)
+}
+
+// auth only lets requests with a token through
+type auth struct {
+	token string
+}
+
+func (a *auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != a.token {
+			http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limit is middleware that names itself
+type limit struct{}
+
+func (limit) Middleware(next http.Handler) http.Handler { return next }
+func (limit) String() string                            { return "limit" }
+
+func TestWith(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/", handler("GET /")))
+	is.NoErr(router.With(&auth{"secret"}, limit{}).Get("/admin", handler("GET /admin")))
+	requestEqual(t, router, "GET /", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET / 
+	`)
+	requestEqual(t, router, "GET /admin", `
+		HTTP/1.1 401 Unauthorized
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		401 unauthorized
+	`)
+	requestEqual(t, router, "GET /admin?token=secret", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /admin token=secret
+	`)
+	routes := router.Routes()
+	is.Equal(len(routes), 2)
+	is.Equal(routes[0].Route, "/")
+	is.Equal(len(routes[0].Middleware), 0)
+	is.Equal(routes[1].Route, "/admin")
+	is.Equal(routes[1].Middleware, []string{"*mux_test.auth", "limit"})
+}
+
+func TestWithGroup(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Use(header("X-Router", "1"))
+	router.UseRoute(limit{})
+	api := router.Group("/api")
+	api.Use(header("X-Api", "1"))
+	var routes mux.Routes = api.With(&auth{"secret"})
+	is.NoErr(routes.Get("/users", handler("GET /api/users")))
+	is.NoErr(api.Get("/posts", handler("GET /api/posts")))
+	requestEqual(t, router, "GET /api/posts", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Api: 1
+		X-Router: 1
+
+		GET /api/posts 
+	`)
+	requestEqual(t, router, "GET /api/users", `
+		HTTP/1.1 401 Unauthorized
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Api: 1
+		X-Content-Type-Options: nosniff
+		X-Router: 1
+
+		401 unauthorized
+	`)
+	route, err := router.Find(http.MethodGet, "/api/users")
+	is.NoErr(err)
+	is.Equal(route.Middleware, []string{"limit", "github.com/livebud/mux_test.header.func1", "*mux_test.auth"})
+	route, err = router.Find(http.MethodGet, "/api/posts")
+	is.NoErr(err)
+	is.Equal(route.Middleware, []string{"limit", "github.com/livebud/mux_test.header.func1"})
+}
+
+// respond with the content type and body
+func respond(status int, contentType, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+}
+
+func TestGroupOptions(t *testing.T) {
+	is := is.New(t)
+	router := mux.New(
+		mux.NotFound(respond(http.StatusNotFound, "text/html", "<h1>Not Found</h1>")),
+	)
+	is.NoErr(router.Get("/", handler("GET /")))
+	api := router.Group("/api",
+		mux.NotFound(respond(http.StatusNotFound, "application/json", `{"error":"not found"}`)),
+		mux.MethodNotAllowed(respond(http.StatusMethodNotAllowed, "application/json", `{"error":"method not allowed"}`)),
+	)
+	is.NoErr(api.Get("/users", handler("GET /api/users")))
+	// Nested groups inherit the options
+	is.NoErr(api.Group("/v2").Post("/users", handler("POST /api/v2/users")))
+	requestEqual(t, router, "GET /missing", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/html
+
+		<h1>Not Found</h1>
+	`)
+	requestEqual(t, router, "GET /apis", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/html
+
+		<h1>Not Found</h1>
+	`)
+	requestEqual(t, router, "GET /api/missing", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: application/json
+
+		{"error":"not found"}
+	`)
+	requestEqual(t, router, "GET /API", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: application/json
+
+		{"error":"not found"}
+	`)
+	requestEqual(t, router, "POST /api/users", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: GET, HEAD, OPTIONS
+		Content-Type: application/json
+
+		{"error":"method not allowed"}
+	`)
+	requestEqual(t, router, "GET /api/v2/users", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: POST, OPTIONS
+		Content-Type: application/json
+
+		{"error":"method not allowed"}
+	`)
+	requestEqual(t, router, "POST /", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: GET, HEAD, OPTIONS
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		405 method not allowed
+	`)
+}
+
+func TestGroupOptionsNested(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	api := router.Group("/api", mux.NotFound(respond(http.StatusNotFound, "application/json", `{"error":"api"}`)))
+	admin := api.Group("/admin", mux.NotFound(respond(http.StatusNotFound, "text/html", "admin")))
+	is.NoErr(admin.Get("/users", handler("GET /api/admin/users")))
+	tenant := router.Host("{tenant}.example.com").Group("/api", mux.NotFound(respond(http.StatusNotFound, "application/json", `{"error":"tenant"}`)))
+	is.NoErr(tenant.Get("/users", handler("GET {tenant}.example.com/api/users")))
+	requestEqual(t, router, "GET /api/admin/missing", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/html
+
+		admin
+	`)
+	requestEqual(t, router, "GET /api/missing", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: application/json
+
+		{"error":"api"}
+	`)
+	requestEqual(t, router, "GET http://acme.example.com/api/missing", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: application/json
+
+		{"error":"tenant"}
+	`)
+	requestEqual(t, router, "GET /missing", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		404 page not found
+	`)
+}
+
+func TestGroupNotAcceptable(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	api := router.Group("/api", mux.NotAcceptable(respond(http.StatusNotAcceptable, "application/json", `{"error":"not acceptable"}`)))
+	is.NoErr(api.Route(http.MethodGet, "/users").Accept("application/json").Handler(handler("GET /api/users")))
+	rec := negotiate(t, router, "/api/users", "text/html")
+	is.Equal(rec.Code, http.StatusNotAcceptable)
+	is.Equal(rec.Body.String(), `{"error":"not acceptable"}`)
+}
+
+func TestGroupQuerySlots(t *testing.T) {
+	router := mux.New()
+	router.Get("/users/{id}", handler("GET /users/{id}"))
+	legacy := router.Group("/legacy", mux.QuerySlots())
+	legacy.Get("/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	requestEqual(t, router, "GET /legacy/users/10", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		id=10
+	`)
+	requestEqual(t, router, "GET /users/10", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users/{id} id=10
+	`)
+}
+
+func TestAPI(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/", handler("GET /")))
+	api := router.Group("/api", mux.API())
+	is.NoErr(api.Get("/users", handler("GET /api/users")))
+	is.NoErr(api.Route(http.MethodGet, "/posts").Accept("application/json").Handler(handler("GET /api/posts")))
+	requestEqual(t, router, "GET /api/missing", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: application/problem+json
+		X-Content-Type-Options: nosniff
+
+		{"type":"about:blank","title":"Not Found","status":404,"detail":"No route matches GET /api/missing","instance":"/api/missing"}
+	`)
+	requestEqual(t, router, "DELETE /api/users", `
+		HTTP/1.1 405 Method Not Allowed
+		Connection: close
+		Allow: GET, HEAD, OPTIONS
+		Content-Type: application/problem+json
+		X-Content-Type-Options: nosniff
+
+		{"type":"about:blank","title":"Method Not Allowed","status":405,"detail":"DELETE /api/users is not allowed, use GET, HEAD, OPTIONS","instance":"/api/users"}
+	`)
+	// Requests that don't match any of a route's matchers are missing too
+	is.NoErr(api.Route(http.MethodGet, "/search").Header("X-Api-Version", "2").Handler(handler("GET /api/search")))
+	requestEqual(t, router, "GET /api/search", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: application/problem+json
+		X-Content-Type-Options: nosniff
+
+		{"type":"about:blank","title":"Not Found","status":404,"detail":"No route matches GET /api/search","instance":"/api/search"}
+	`)
+	rec := negotiate(t, router, "/api/posts", "text/html")
+	is.Equal(rec.Code, http.StatusNotAcceptable)
+	is.Equal(rec.Header().Get("Content-Type"), "application/problem+json")
+	is.Equal(rec.Body.String(), `{"type":"about:blank","title":"Not Acceptable","status":406,"detail":"GET /api/posts can't respond with a media type accepted by \"text/html\"","instance":"/api/posts"}`+"\n")
+	// Routes outside the group still respond with text
+	requestEqual(t, router, "GET /missing", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		404 page not found
+	`)
+}
+
+func TestProblem(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/users/{id}", &mux.Problem{
+		Type:   "https://example.com/problems/suspended",
+		Title:  "Account suspended",
+		Status: http.StatusForbidden,
+		Detail: "The account is suspended until 2026-11-01",
+	}))
+	requestEqual(t, router, "GET /users/10", `
+		HTTP/1.1 403 Forbidden
+		Connection: close
+		Content-Type: application/problem+json
+		X-Content-Type-Options: nosniff
+
+		{"type":"https://example.com/problems/suspended","title":"Account suspended","status":403,"detail":"The account is suspended until 2026-11-01","instance":"/users/10"}
+	`)
+	var err error = &mux.Problem{Status: http.StatusNotFound, Detail: "user 10 not found"}
+	is.Equal(err.Error(), "404 Not Found: user 10 not found")
+	var problem *mux.Problem
+	is.True(errors.As(err, &problem))
+	is.Equal((&mux.Problem{}).Error(), "500 Internal Server Error")
+}
+
+// users handler that returns errors
+func users(w http.ResponseWriter, r *http.Request) error {
+	switch id := r.PathValue("id"); id {
+	case "1":
+		w.Write([]byte("user 1"))
+		return nil
+	case "2":
+		return &mux.StatusError{Status: http.StatusForbidden, Err: errors.New("user 2 is private")}
+	case "3":
+		return fmt.Errorf("finding user 3: %w", mux.ErrNoMatch)
+	case "4":
+		return &mux.Problem{Status: http.StatusConflict, Detail: "user 4 is being updated"}
+	default:
+		return fmt.Errorf("database is down")
+	}
+}
+
+func TestHandlerFunc(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/users/{id}", mux.HandlerFunc(users)))
+	requestEqual(t, router, "GET /users/1", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		user 1
+	`)
+	requestEqual(t, router, "GET /users/2", `
+		HTTP/1.1 403 Forbidden
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		user 2 is private
+	`)
+	requestEqual(t, router, "GET /users/3", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		finding user 3: no match
+	`)
+	requestEqual(t, router, "GET /users/4", `
+		HTTP/1.1 409 Conflict
+		Connection: close
+		Content-Type: application/problem+json
+		X-Content-Type-Options: nosniff
+
+		{"type":"about:blank","title":"Conflict","status":409,"detail":"user 4 is being updated","instance":"/users/4"}
+	`)
+	// Server errors don't leak the error message
+	requestEqual(t, router, "GET /users/5", `
+		HTTP/1.1 500 Internal Server Error
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		Internal Server Error
+	`)
+}
+
+func TestErrorHandler(t *testing.T) {
+	is := is.New(t)
+	var logged []error
+	router := mux.New(mux.ErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		logged = append(logged, err)
+		w.WriteHeader(mux.StatusOf(err))
+		w.Write([]byte("oops"))
+	}))
+	is.NoErr(router.Get("/users/{id}", mux.HandlerFunc(users)))
+	api := router.Group("/api", mux.API())
+	is.NoErr(api.Get("/users/{id}", mux.HandlerFunc(users)))
+	requestEqual(t, router, "GET /users/2", `
+		HTTP/1.1 403 Forbidden
+		Connection: close
+
+		oops
+	`)
+	is.Equal(len(logged), 1)
+	requestEqual(t, router, "GET /api/users/2", `
+		HTTP/1.1 403 Forbidden
+		Connection: close
+		Content-Type: application/problem+json
+		X-Content-Type-Options: nosniff
+
+		{"type":"about:blank","title":"Forbidden","status":403,"detail":"user 2 is private","instance":"/api/users/2"}
+	`)
+	requestEqual(t, router, "GET /api/users/5", `
+		HTTP/1.1 500 Internal Server Error
+		Connection: close
+		Content-Type: application/problem+json
+		X-Content-Type-Options: nosniff
+
+		{"type":"about:blank","title":"Internal Server Error","status":500,"instance":"/api/users/5"}
+	`)
+	is.Equal(len(logged), 1)
+}
+
+func TestStatusOf(t *testing.T) {
+	is := is.New(t)
+	is.Equal(mux.StatusOf(errors.New("unknown")), http.StatusInternalServerError)
+	is.Equal(mux.StatusOf(fmt.Errorf("wrapped: %w", mux.ErrNoMatch)), http.StatusNotFound)
+	// Missing files are usually server bugs, like a missing template
+	is.Equal(mux.StatusOf(fmt.Errorf("wrapped: %w", fs.ErrNotExist)), http.StatusInternalServerError)
+	is.Equal(mux.StatusOf(fs.ErrPermission), http.StatusInternalServerError)
+	is.Equal(mux.StatusOf(&mux.StatusError{Status: http.StatusTeapot}), http.StatusTeapot)
+	is.Equal(mux.StatusOf(&mux.Problem{Status: http.StatusBadRequest}), http.StatusBadRequest)
+	// Registration errors aren't resource conflicts
+	is.Equal(mux.StatusOf(fmt.Errorf("wrapped: %w", mux.ErrDuplicate)), http.StatusInternalServerError)
+	is.Equal((&mux.StatusError{Status: http.StatusTeapot}).Error(), "I'm a teapot")
+	// Standalone handlers use the default error handler
+	rec := httptest.NewRecorder()
+	mux.HandlerFunc(users).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	is.Equal(rec.Code, http.StatusInternalServerError)
+	// Their messages aren't sent to the client
+	rec = httptest.NewRecorder()
+	mux.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		_, err := os.ReadFile("/srv/app/templates/missing.html")
+		return err
+	}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	is.Equal(rec.Code, http.StatusInternalServerError)
+	is.Equal(rec.Body.String(), "Internal Server Error\n")
+}
+
+func TestConstraints(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/users/{id:int}", handler("GET /users/{id:int}")))
+	is.NoErr(router.Get("/users/{name}", handler("GET /users/{name}")))
+	is.NoErr(router.Get("/posts/{id:uuid}", handler("GET /posts/{id:uuid}")))
+	is.NoErr(router.Get("/archive/{day:date}", handler("GET /archive/{day:date}")))
+	is.NoErr(router.Get("/tags/{tag:alpha}/{page:uint}", handler("GET /tags/{tag:alpha}/{page:uint}")))
+	is.NoErr(router.Get("/articles/{slug:slug}", handler("GET /articles/{slug:slug}")))
+	requestEqual(t, router, "GET /users/10", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users/{id:int} id=10
+	`)
+	// Invalid values fall through to other routes
+	requestEqual(t, router, "GET /users/alice", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /users/{name} name=alice
+	`)
+	requestEqual(t, router, "GET /posts/0F8FAD5B-D9CB-469F-A165-70867728950E", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /posts/{id:uuid} id=0F8FAD5B-D9CB-469F-A165-70867728950E
+	`)
+	requestEqual(t, router, "GET /archive/2026-10-17", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /archive/{day:date} day=2026-10-17
+	`)
+	requestEqual(t, router, "GET /tags/go/2", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /tags/{tag:alpha}/{page:uint} page=2&tag=go
+	`)
+	requestEqual(t, router, "GET /articles/hello-world", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /articles/{slug:slug} slug=hello-world
+	`)
+	// Invalid values fall through to 404
+	for _, path := range []string{"/posts/10", "/archive/yesterday", "/tags/go/-2", "/tags/go1/2", "/articles/hello--world"} {
+		requestEqual(t, router, "GET "+path, `
+			HTTP/1.1 404 Not Found
+			Connection: close
+			Content-Type: text/plain; charset=utf-8
+			X-Content-Type-Options: nosniff
+
+			404 page not found
+		`)
+	}
+	// Routes are listed with their constraints
+	route, err := router.Find(http.MethodGet, "/users/{id:int}")
+	is.NoErr(err)
+	is.Equal(route.Route, "/users/{id:int}")
+	is.Equal(route.Regexp(), "/users/{id|^-?[0-9]+$}")
+	match, err := router.Match(http.MethodGet, "/users/10")
+	is.NoErr(err)
+	is.Equal(match.Route, "/users/{id:int}")
+	status, body := serveRequest(router, http.MethodGet, "/users/10")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "GET /users/{id:int} id=10")
+	explanation := router.Explain(http.MethodGet, "/users/ten")
+	is.Equal(explanation.Tried[0].Route, "/users/{id:int}")
+	is.Equal(explanation.Tried[0].Reason, `{id:int} rejected "ten"`)
+	conflicts := router.Check()
+	is.Equal(len(conflicts), 1)
+	is.Equal(conflicts[0].String(), "GET /users/{name} is shadowed by GET /users/{id:int} for /users/0")
+	is.NoErr(router.Name("post").Get("/blog/{id:int}", handler("GET /blog/{id:int}")))
+	_, err = router.URL("post", "id", "ten")
+	var invalid *mux.InvalidSlotError
+	is.True(errors.As(err, &invalid))
+	is.Equal(invalid.Route, "/blog/{id:int}")
+	err = router.Get("/comments/{id:number}", handler("GET /comments/{id:number}"))
+	is.True(err != nil)
+	is.Equal(err.Error(), `router: unknown constraint "number" in slot "id:number"`)
+}
+
+func TestCustomConstraints(t *testing.T) {
+	is := is.New(t)
+	router := mux.New(mux.Constraint("version", `v[0-9]+|latest`))
+	is.NoErr(router.Get("/docs/{version:version}/{page}", handler("GET /docs/{version:version}/{page}")))
+	is.NoErr(router.Get("/files/{id|[0-9]{4}}/{name:alpha}", handler("GET /files/{id|[0-9]{4}}/{name:alpha}")))
+	api := router.Group("/api", mux.Constraint("sku", `[A-Z]{3}-[0-9]{4}`))
+	is.NoErr(api.Get("/products/{sku:sku}", handler("GET /api/products/{sku:sku}")))
+	err := router.Get("/products/{sku:sku}", handler("GET /products/{sku:sku}"))
+	is.True(err != nil)
+	requestEqual(t, router, "GET /docs/latest/intro", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /docs/{version:version}/{page} page=intro&version=latest
+	`)
+	requestEqual(t, router, "GET /docs/v2/intro", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /docs/{version:version}/{page} page=intro&version=v2
+	`)
+	requestEqual(t, router, "GET /docs/latest2/intro", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		404 page not found
+	`)
+	requestEqual(t, router, "GET /files/2026/report", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /files/{id|[0-9]{4}}/{name:alpha} id=2026&name=report
+	`)
+	requestEqual(t, router, "GET /api/products/ABC-1234", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		GET /api/products/{sku:sku} sku=ABC-1234
+	`)
+	// URLs are validated against the constraint
+	is.NoErr(router.Name("doc").Get("/named/{version:version}", handler("GET /named/{version:version}")))
+	u, err := router.URL("doc", "version", "v3")
+	is.NoErr(err)
+	is.Equal(u, "/named/v3")
+	_, err = router.URL("doc", "version", "v3.1")
+	var invalid *mux.InvalidSlotError
+	is.True(errors.As(err, &invalid))
+}
+
+func TestSlotAccessors(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/users/{id:int}/{day:date}/{page:uint}", mux.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := mux.Int(r, "id")
+		if err != nil {
+			return err
+		}
+		day, err := mux.Date(r, "day")
+		if err != nil {
+			return err
+		}
+		page, err := mux.Uint(r, "page")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%d %s %d", id, day.Weekday(), page)
+		return nil
+	})))
+	requestEqual(t, router, "GET /users/-10/2026-10-17/3", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+
+		-10 Saturday 3
+	`)
+	// The date matches the constraint, but isn't a valid date
+	requestEqual(t, router, "GET /users/10/2026-02-30/3", `
+		HTTP/1.1 400 Bad Request
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		router: slot "day" is not a valid date. parsing time "2026-02-30": day out of range
+	`)
+	_, err := mux.Int(httptest.NewRequest(http.MethodGet, "/", nil), "id")
+	is.Equal(mux.StatusOf(err), http.StatusBadRequest)
+}
+
+type showUser struct {
+	ID      int      `path:"id"`
+	Fields  []string `query:"fields"`
+	Verbose *bool    `query:"verbose"`
+}
+
+type createUser struct {
+	Org    string `path:"org"`
+	Name   string `json:"name,required"`
+	Email  string `json:"email"`
+	Notify bool   `query:"notify"`
+}
+
+type user struct {
+	ID     int      `json:"id"`
+	Org    string   `json:"org,omitempty"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields,omitempty"`
+	Notify bool     `json:"notify,omitempty"`
+}
+
+// userAPI is a mountable with typed handlers
+type userAPI struct{}
+
+func (userAPI) Mount(routes mux.Routes) {
+	routes.Get("/users/{id:int}", mux.JSON(func(ctx context.Context, in showUser) (*user, error) {
+		if in.ID == 404 {
+			return nil, &mux.StatusError{Status: http.StatusNotFound, Err: fmt.Errorf("user %d not found", in.ID)}
+		}
+		name := "alice"
+		if in.Verbose != nil && *in.Verbose {
+			name = "Alice Liddell"
+		}
+		return &user{ID: in.ID, Name: name, Fields: in.Fields}, nil
+	}))
+	routes.Post("/orgs/{org}/users", mux.JSON(func(ctx context.Context, in *createUser) (*user, error) {
+		return &user{ID: 1, Org: in.Org, Name: in.Name, Notify: in.Notify}, nil
+	}))
+}
+
+func TestJSON(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Mount(userAPI{})
+	requestEqual(t, router, "GET /users/10?fields=name&fields=email&verbose=true", `
+		HTTP/1.1 200 OK
+		Connection: close
+		Content-Type: application/json
+
+		{"id":10,"name":"Alice Liddell","fields":["name","email"]}
+	`)
+	requestEqual(t, router, "GET /users/10?verbose=maybe", `
+		HTTP/1.1 400 Bad Request
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		router: query "verbose" is not a valid *bool
+	`)
+	requestEqual(t, router, "GET /users/404", `
+		HTTP/1.1 404 Not Found
+		Connection: close
+		Content-Type: text/plain; charset=utf-8
+		X-Content-Type-Options: nosniff
+
+		user 404 not found
+	`)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := post("/orgs/acme/users?notify=1", `{"name":"bob","org":"ignored"}`)
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Body.String(), `{"id":1,"org":"acme","name":"bob","notify":true}`+"\n")
+	rec = post("/orgs/acme/users", `{"email":"bob@example.com"}`)
+	is.Equal(rec.Code, http.StatusBadRequest)
+	is.Equal(rec.Body.String(), `router: json "name" is required`+"\n")
+	// Required fields can be zero values, but not null
+	rec = post("/orgs/acme/users", `{"name":""}`)
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Body.String(), `{"id":1,"org":"acme","name":""}`+"\n")
+	rec = post("/orgs/acme/users", `{"Name":""}`)
+	is.Equal(rec.Code, http.StatusOK)
+	rec = post("/orgs/acme/users", `{"name":null}`)
+	is.Equal(rec.Code, http.StatusBadRequest)
+	is.Equal(rec.Body.String(), `router: json "name" is required`+"\n")
+	rec = post("/orgs/acme/users", `[]`)
+	is.Equal(rec.Code, http.StatusBadRequest)
+	rec = post("/orgs/acme/users", ``)
+	is.Equal(rec.Code, http.StatusBadRequest)
+	is.Equal(rec.Body.String(), `router: json "name" is required`+"\n")
+	rec = post("/orgs/acme/users", `{"name":`)
+	is.Equal(rec.Code, http.StatusBadRequest)
+	is.Equal(rec.Body.String(), "router: unable to decode the request body. unexpected EOF\n")
+}
+
+func TestJSONProblems(t *testing.T) {
+	router := mux.New()
+	router.Group("/api", mux.API()).Mount(userAPI{})
+	requestEqual(t, router, "GET /api/users/10?verbose=maybe", `
+		HTTP/1.1 400 Bad Request
+		Connection: close
+		Content-Type: application/problem+json
+		X-Content-Type-Options: nosniff
+
+		{"type":"about:blank","title":"Bad Request","status":400,"detail":"router: query \"verbose\" is not a valid *bool","instance":"/api/users/10"}
+	`)
+}
+
+func TestJSONUnbindable(t *testing.T) {
+	is := is.New(t)
+	defer func() {
+		is.Equal(fmt.Sprint(recover()), `router: unable to bind query "filter" to field Filter of type map[string]string`)
+	}()
+	mux.JSON(func(ctx context.Context, in struct {
+		Filter map[string]string `query:"filter"`
+	}) (struct{}, error) {
+		return struct{}{}, nil
+	})
+}
+
+func TestHandle(t *testing.T) {
+	is := is.New(t)
+	patterns := map[string][]string{
+		"GET /{$}":             nil,
+		"GET /users/{userID}":  {"userID"},
+		"POST /users":          nil,
+		"GET /files/{path...}": {"path"},
+		"/static/":             nil,
+		"GET api.example.com/users/{id}/{rest...}": {"id", "rest"},
+		"DELETE /posts/{id}/{$}":                   {"id"},
+	}
+	router := mux.New()
+	serveMux := http.NewServeMux()
+	for pattern, names := range patterns {
+		is.NoErr(router.Handle(pattern, pathValues(pattern, names...)))
+		serveMux.Handle(pattern, pathValues(pattern, names...))
+	}
+	// Both route these requests the same way, though their error bodies differ
+	requests := []string{
+		"GET /",
+		"GET /users/10",
+		"POST /users",
+		"GET /files/a/b/c.txt",
+		"GET /static/css/app.css",
+		"PUT /static/css/app.css",
+		"GET http://api.example.com/users/10/a/b",
+		"GET http://api.example.com:3000/users/10/a",
+		"DELETE /posts/10/",
+		"PATCH /users/10",
+		"GET /posts/10/comments",
+	}
+	for _, request := range requests {
+		method, target, _ := strings.Cut(request, " ")
+		expect, expectBody := serveRequest(serveMux, method, target)
+		actual, actualBody := serveRequest(router, method, target)
+		is.Equal(actual, expect) // status
+		if expect == http.StatusOK {
+			is.Equal(actualBody, expectBody) // body
+		}
+	}
+	routes := router.Routes()
+	is.Equal(routes[0].String(), "GET /")
+	is.Equal(routes[1].String(), "GET /files/{path*}")
+	is.Equal(routes[2].String(), "GET /files/{path*}")
+	is.Equal(routes[3].String(), "GET /static/{rest*}")
+	is.Equal(routes[4].String(), "GET /static/{rest*}")
+	is.Equal(routes[5].String(), "GET /users/{user_id}")
+	is.Equal(routes[6].String(), "GET api.example.com/users/{id}/{rest*}")
+	// Patterns without a method leave OPTIONS to the automatic response
+	var static []string
+	for _, route := range routes {
+		if route.Route == "/static/{rest*}" {
+			static = append(static, route.Method)
+		}
+	}
+	// Wildcard slots are listed once per expansion
+	is.Equal(strings.Join(slices.Compact(static), " "), "GET HEAD POST PUT PATCH DELETE")
+	req := httptest.NewRequest(http.MethodOptions, "/static/css/app.css", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNoContent)
+	is.Equal(rec.Header().Get("Allow"), "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+	status, _ := serveRequest(router, http.MethodTrace, "/static/css/app.css")
+	is.Equal(status, http.StatusMethodNotAllowed)
+	// The path below a trailing slash is the rest slot
+	is.NoErr(router.Handle("GET /assets/", pathValues("GET /assets/", "rest")))
+	status, body := serveRequest(router, http.MethodGet, "/assets/css/app.css")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "GET /assets/ rest=css/app.css")
+}
+
+func TestHandlePrecedence(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	serveMux := http.NewServeMux()
+	// ServeMux matches case-sensitively and requires the trailing slash of
+	// {$}, while the router ignores case and trailing slashes
+	is.NoErr(router.Handle("GET /users/{$}", pathValues("GET /users/{$}")))
+	serveMux.Handle("GET /users/{$}", pathValues("GET /users/{$}"))
+	status, body := serveRequest(serveMux, http.MethodGet, "/Users/")
+	is.Equal(status, http.StatusNotFound)
+	status, body = serveRequest(router, http.MethodGet, "/Users/")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "GET /users/{$}")
+	status, _ = serveRequest(serveMux, http.MethodGet, "/users")
+	is.Equal(status, http.StatusTemporaryRedirect)
+	status, _ = serveRequest(router, http.MethodGet, "/users")
+	is.Equal(status, http.StatusOK)
+	// ServeMux redirects to the trailing slash of a subtree, while the router
+	// matches it directly
+	is.NoErr(router.Handle("/static/", pathValues("/static/")))
+	serveMux.Handle("/static/", pathValues("/static/"))
+	status, _ = serveRequest(serveMux, http.MethodGet, "/static")
+	is.Equal(status, http.StatusTemporaryRedirect)
+	status, body = serveRequest(router, http.MethodGet, "/static")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "/static/")
+	// ServeMux panics on conflicting patterns, while the router matches the
+	// longest static prefix
+	is.NoErr(router.Handle("GET /posts/{id}", pathValues("GET /posts/{id}", "id")))
+	is.NoErr(router.Handle("GET /{resource}/latest", pathValues("GET /{resource}/latest", "resource")))
+	status, body = serveRequest(router, http.MethodGet, "/posts/latest")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "GET /posts/{id} id=latest")
+	status, body = serveRequest(router, http.MethodGet, "/comments/latest")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "GET /{resource}/latest resource=comments")
+	// ServeMux's {rest...} needs the slash before it, while the router's
+	// wildcard slots also match without it
+	is.NoErr(router.Handle("GET /files/{path...}", pathValues("GET /files/{path...}", "path")))
+	serveMux.Handle("GET /files/{path...}", pathValues("GET /files/{path...}", "path"))
+	status, _ = serveRequest(serveMux, http.MethodGet, "/files")
+	is.Equal(status, http.StatusTemporaryRedirect)
+	status, body = serveRequest(router, http.MethodGet, "/files")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "GET /files/{path...} path=")
+	// Patterns with a method take precedence when registered first
+	is.NoErr(router.Handle("GET /teams", pathValues("GET /teams")))
+	is.NoErr(router.Handle("/teams", pathValues("/teams")))
+	status, body = serveRequest(router, http.MethodGet, "/teams")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "GET /teams")
+	status, _ = serveRequest(router, http.MethodHead, "/teams")
+	is.Equal(status, http.StatusOK)
+	status, body = serveRequest(router, http.MethodPost, "/teams")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "/teams")
+	err := router.Handle("POST /teams", pathValues("POST /teams"))
+	is.True(errors.Is(err, mux.ErrDuplicate))
+}
+
+func TestHandleInvalid(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	err := router.Handle("FETCH /users", http.HandlerFunc(noop))
+	is.Equal(err.Error(), `router: "FETCH" is not a valid HTTP method in pattern "FETCH /users"`)
+	err = router.Handle("GET users", http.HandlerFunc(noop))
+	is.Equal(err.Error(), `router: pattern "GET users" is missing a path`)
+	err = router.Handle("GET /users/id-{id}", http.HandlerFunc(noop))
+	is.Equal(err.Error(), `router: wildcards in pattern "GET /users/id-{id}" must be whole path segments`)
+	err = router.Handle("GET /{path...}/edit", http.HandlerFunc(noop))
+	is.Equal(err.Error(), `router: {path...} in pattern "GET /{path...}/edit" must be at the end`)
+	err = router.Handle("GET /{$}/edit", http.HandlerFunc(noop))
+	is.Equal(err.Error(), `router: {$} in pattern "GET /{$}/edit" must be at the end`)
+	err = router.Handle("GET /users/{rest}/", http.HandlerFunc(noop))
+	is.Equal(err.Error(), `router: {rest} in pattern "GET /users/{rest}/" is taken by the trailing slash`)
+	is.Equal(len(router.Routes()), 0)
+}
+
+func TestCheck(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/users/{id}", handler("GET /users/{id}")))
+	is.NoErr(router.Get("/{owner}/{repo}", handler("GET /{owner}/{repo}")))
+	is.NoErr(router.Get("/static/{path*}", handler("GET /static/{path*}")))
+	is.NoErr(router.Get("/tags/{name|[a-z]+}", handler("GET /tags/{name|[a-z]+}")))
+	is.NoErr(router.Get("/tags/{slug|[a-z0-9-]+}", handler("GET /tags/{slug|[a-z0-9-]+}")))
+	is.NoErr(router.Get("/files/{path|[^/]+}", handler("GET /files/{path|[^/]+}")))
+	is.NoErr(router.Get("/files/{name}", handler("GET /files/{name}")))
+	conflicts := router.Check()
+	is.Equal(len(conflicts), 7)
+	is.Equal(conflicts[0].Kind, mux.Unreachable)
+	is.Equal(conflicts[0].Route.Route, "/files/{name}")
+	is.Equal(conflicts[0].By.Route, "/files/{path|^[^/]+$}")
+	is.Equal(conflicts[1].Kind, mux.Ambiguous)
+	is.Equal(conflicts[1].Path, "/tags/x")
+	is.Equal(conflicts[2].Kind, mux.Shadowed)
+	is.Equal(conflicts[2].Route.Route, "/{owner}/{repo}")
+	is.Equal(conflicts[2].By.Route, "/files/{path|^[^/]+$}")
+	diff.TestString(t, router.Check().Err().Error(), strings.Join([]string{
+		"router: found 7 route conflicts",
+		"  GET /files/{name} is unreachable, /files/x goes to GET /files/{path|^[^/]+$}",
+		"  GET /tags/{slug|^[a-z0-9-]+$} and GET /tags/{name|^[a-z]+$} both match /tags/x, which goes to GET /tags/{name|^[a-z]+$}",
+		"  GET /{owner}/{repo} is shadowed by GET /files/{path|^[^/]+$} for /files/x",
+		"  GET /{owner}/{repo} is shadowed by GET /static/{path*} for /static/x",
+		"  GET /{owner}/{repo} is shadowed by GET /tags/{name|^[a-z]+$} for /tags/x",
+		"  GET /{owner}/{repo} is shadowed by GET /tags/{slug|^[a-z0-9-]+$} for /tags/0",
+		"  GET /{owner}/{repo} is shadowed by GET /users/{id} for /users/x",
+	}, "\n"))
+}
+
+func TestCheckClean(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/", handler("GET /")))
+	is.NoErr(router.Get("/users", handler("GET /users")))
+	// Static routes that special-case a path aren't conflicts
+	is.NoErr(router.Get("/users/new", handler("GET /users/new")))
+	is.NoErr(router.Get("/users/{id}.{format?}", handler("GET /users/{id}.{format?}")))
+	is.NoErr(router.Get("/users/{id}/edit", handler("GET /users/{id}/edit")))
+	is.NoErr(router.Get("/posts/{post_id}/comments/{id}", handler("GET /posts/{post_id}/comments/{id}")))
+	is.NoErr(router.Get("/v{major|[0-9]+}.{minor|[0-9]+}", handler("GET /v{major}.{minor}")))
+	is.NoErr(router.Get("/files/{path*}", handler("GET /files/{path*}")))
+	is.NoErr(router.Post("/users", handler("POST /users")))
+	// Routes are only checked against routes with the same method and host
+	is.NoErr(router.Delete("/{owner}/{repo}", handler("DELETE /{owner}/{repo}")))
+	is.NoErr(router.Host("{tenant}.example.com").Get("/{owner}/{repo}", handler("GET /{owner}/{repo}")))
+	is.Equal(len(router.Check()), 0)
+	is.NoErr(router.Check().Err())
+}
+
+func TestExplain(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/flights/{from}-{to}", handler("GET /flights/{from}-{to}")))
+	is.NoErr(router.Get("/flights/{id|[0-9]+}", handler("GET /flights/{id|[0-9]+}")))
+	is.NoErr(router.Get("/{owner}/{repo}", handler("GET /{owner}/{repo}")))
+	is.NoErr(router.Post("/flights/{id}", handler("POST /flights/{id}")))
+	explanation := router.Explain(http.MethodGet, "/flights/sfo")
+	is.Equal(explanation.Route, "/{owner}/{repo}")
+	is.Equal(explanation.Slots, map[string]string{"owner": "flights", "repo": "sfo"})
+	is.Equal(explanation.Methods, []string{http.MethodGet, http.MethodPost})
+	is.Equal(len(explanation.Closest), 0)
+	diff.TestString(t, explanation.String(), strings.Join([]string{
+		"GET /flights/sfo matches /{owner}/{repo}",
+		"tried:",
+		`  /flights/{id|^[0-9]+$}: {id|^[0-9]+$} rejected "sfo"`,
+		"  /flights/{from}-{to}: the path ended before -",
+		"  /{owner}/{repo} matched",
+		"methods matching the path: GET, POST",
+	}, "\n"))
+	// Slots stop at the delimiters of every route in the same place
+	explanation = router.Explain(http.MethodGet, "/flights/sfo-lax")
+	is.Equal(explanation.Route, "/flights/{from}-{to}")
+	is.Equal(explanation.Slots, map[string]string{"from": "sfo", "to": "lax"})
+	is.Equal(len(explanation.Tried), 2)
+	steps := explanation.Tried[1].Steps
+	is.Equal(len(steps), 6)
+	is.Equal(steps[3].Section, "{from}")
+	is.Equal(steps[3].Input, "sfo-lax")
+	is.Equal(steps[3].Matched, "sfo")
+	is.Equal(steps[4].Section, "-")
+	is.Equal(steps[5].Matched, "lax")
+	// HEAD requests fall back to GET routes
+	explanation = router.Explain(http.MethodHead, "/flights/10/")
+	is.Equal(explanation.Route, "/flights/{id|^[0-9]+$}")
+	is.Equal(len(explanation.Tried), 1)
+}
+
+func TestExplainNoMatch(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/flights/{from}-{to}", handler("GET /flights/{from}-{to}")))
+	is.NoErr(router.Get("/flights/{id|[0-9]+}/seats", handler("GET /flights/{id|[0-9]+}/seats")))
+	is.NoErr(router.Get("/users", handler("GET /users")))
+	is.NoErr(router.Post("/flights/{id}/seats", handler("POST /flights/{id}/seats")))
+	explanation := router.Explain(http.MethodGet, "/flights/sfo/seats")
+	is.Equal(explanation.Match, nil)
+	is.Equal(explanation.Route, "")
+	is.True(strings.Contains(explanation.Error, "no match"))
+	is.Equal(explanation.Methods, []string{http.MethodPost})
+	is.Equal(len(explanation.Tried), 3)
+	is.Equal(len(explanation.Closest), 3)
+	is.Equal(explanation.Closest[0].Route, "/flights/{from}-{to}")
+	is.Equal(explanation.Closest[0].Matched, "/flights/sfo")
+	is.Equal(explanation.Closest[1].Route, "/flights/{id|^[0-9]+$}/seats")
+	is.Equal(explanation.Closest[1].Matched, "/flights/")
+	diff.TestString(t, explanation.String(), strings.Join([]string{
+		`GET /flights/sfo/seats doesn't match a route: ` + explanation.Error,
+		"tried:",
+		`  /flights/{id|^[0-9]+$}/seats: {id|^[0-9]+$} rejected "sfo"`,
+		`  /flights/{from}-{to}: expected "-" at "/seats"`,
+		`  /users: expected "users" at "flights/sfo/seats"`,
+		"methods matching the path: POST",
+		"closest:",
+		`  /flights/{from}-{to}: expected "-" at "/seats"`,
+		`  /flights/{id|^[0-9]+$}/seats: {id|^[0-9]+$} rejected "sfo"`,
+		`  /users: expected "users" at "flights/sfo/seats"`,
+	}, "\n"))
+	// Methods without routes have nothing to try
+	explanation = router.Explain(http.MethodDelete, "/users")
+	is.Equal(len(explanation.Tried), 0)
+	is.Equal(explanation.Methods, []string{http.MethodGet})
+}
+
+func TestExplainHandler(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/users/{id|[0-9]+}", handler("GET /users/{id|[0-9]+}")))
+	explain := mux.ExplainHandler(router)
+	rec := httptest.NewRecorder()
+	explain.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_explain?method=get&path=/users/abc", nil))
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Header().Get("Content-Type"), "application/json")
+	var explanation mux.Explanation
+	is.NoErr(json.Unmarshal(rec.Body.Bytes(), &explanation))
+	is.Equal(explanation.Method, http.MethodGet)
+	is.Equal(explanation.Path, "/users/abc")
+	is.Equal(explanation.Route, "")
+	is.Equal(len(explanation.Tried), 1)
+	is.Equal(explanation.Tried[0].Route, "/users/{id|^[0-9]+$}")
+	is.Equal(explanation.Tried[0].Reason, `{id|^[0-9]+$} rejected "abc"`)
+	status, body := serveRequest(explain, http.MethodGet, "/_explain")
+	is.Equal(status, http.StatusBadRequest)
+	is.True(strings.Contains(body, "missing the path"))
+}
+
+func TestRouteSource(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	_, file, line, _ := runtime.Caller(0)
+	is.NoErr(router.Get("/users", handler("GET /users")))
+	is.NoErr(router.Handle("POST /users", handler("POST /users")))
+	is.NoErr(router.Route("GET", "/search").Query("q", "{q}").Handler(handler("GET /search")))
+	is.NoErr(router.Replace("GET", "/", handler("GET /")))
+	router.Group("/slack").Mount(&slackHandler{})
+	routes := router.Routes()
+	is.Equal(len(routes), 6)
+	sources := map[string]string{}
+	for _, route := range routes {
+		sources[route.String()] = route.Source
+	}
+	is.Equal(sources["GET /users"], fmt.Sprintf("%s:%d", file, line+1))
+	is.Equal(sources["POST /users"], fmt.Sprintf("%s:%d", file, line+2))
+	is.Equal(sources["GET /search"], fmt.Sprintf("%s:%d", file, line+3))
+	is.Equal(sources["GET /"], fmt.Sprintf("%s:%d", file, line+4))
+	// Mounted routes are registered by the mountable
+	is.True(strings.HasPrefix(sources["POST /slack/events"], file+":"))
+	is.True(sources["POST /slack/events"] != sources["GET /slack/commands"])
+	found, err := router.Find(http.MethodGet, "/users")
+	is.NoErr(err)
+	is.Equal(found.Source, sources["GET /users"])
+}
+
+func TestDebug(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	_, file, line, _ := runtime.Caller(0)
+	is.NoErr(router.Name("show_user").Get("/users/{id}.{format?}", handler("GET /users/{id}.{format?}")))
+	is.NoErr(router.With(limit{}).Post("/users", mux.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error { return nil })))
+	is.NoErr(router.Route("GET", "/search").Query("q", "{q}").Handler(http.NotFoundHandler()))
+	is.NoErr(router.Get("/_routes", mux.Debug(router)))
+	status, body := serveRequest(router, http.MethodGet, "/_routes")
+	is.Equal(status, http.StatusOK)
+	is.True(strings.Contains(body, "<td>/users/{id}.{format?}</td>"))
+	is.True(strings.Contains(body, "<td>show_user</td>"))
+	is.True(strings.Contains(body, fmt.Sprintf("<td>%s:%d</td>", file, line+1)))
+	is.True(strings.Contains(body, "<td>limit</td>"))
+	is.True(strings.Contains(body, "<td>github.com/livebud/mux_test.TestDebug.func1</td>"))
+	is.True(strings.Contains(body, "<td>/search<br>query q={q}</td>"))
+	is.True(strings.Contains(body, "<td>net/http.NotFound</td>"))
+	is.True(strings.Contains(body, "<td>*mux.debugger</td>"))
+	// Routes with optional slots are listed once
+	is.Equal(strings.Count(body, "<td>/users/{id}.{format?}</td>"), 1)
+	// Search the routes
+	_, body = serveRequest(router, http.MethodGet, "/_routes?q=LIMIT")
+	is.True(strings.Contains(body, "<td>/users</td>"))
+	is.True(!strings.Contains(body, "<td>/search"))
+	// Try a path
+	_, body = serveRequest(router, http.MethodGet, "/_routes?method=get&path=/users/10.json")
+	is.True(strings.Contains(body, "GET /users/10.json matches /users/{id}.{format?}"))
+	is.True(strings.Contains(body, "<tr><td>id</td><td>10</td></tr>"))
+	is.True(strings.Contains(body, "<tr><td>format</td><td>json</td></tr>"))
+	is.True(strings.Contains(body, "<option selected>GET</option>"))
+	_, body = serveRequest(router, http.MethodGet, "/_routes?method=DELETE&path=/users/10%3Cb%3E")
+	is.True(strings.Contains(body, `<p class="error">router: no match found for DELETE /users/10&lt;b&gt;</p>`))
+}
+
+func TestDebugJSON(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Name("show_user").Get("/users/{id}.{format?}", handler("GET /users/{id}.{format?}")))
+	is.NoErr(router.Host("{tenant}.example.com").With(limit{}).Post("/users", handler("POST /users")))
+	show, err := router.Find(http.MethodGet, "/users/{id}.{format?}")
+	is.NoErr(err)
+	create, err := router.Host("{tenant}.example.com").Find(http.MethodPost, "/users")
+	is.NoErr(err)
+	debug := mux.Debug(router)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/_routes?path=/users/10.json", nil)
+	req.Header.Set("Accept", "application/json")
+	debug.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Header().Get("Content-Type"), "application/json")
+	diff.TestString(t, rec.Body.String(), `{
+  "routes": [
+    {
+      "method": "GET",
+      "pattern": "/users/{id}.{format?}",
+      "handler": "github.com/livebud/mux_test.handler.func1",
+      "name": "show_user",
+      "source": "`+show.Source+`"
+    },
+    {
+      "method": "POST",
+      "pattern": "{tenant}.example.com/users",
+      "handler": "github.com/livebud/mux_test.handler.func1",
+      "middleware": [
+        "limit"
+      ],
+      "source": "`+create.Source+`"
+    }
+  ],
+  "try": {
+    "method": "GET",
+    "path": "/users/10.json",
+    "route": "/users/{id}.{format?}",
+    "slots": [
+      {
+        "key": "id",
+        "value": "10"
+      },
+      {
+        "key": "format",
+        "value": "json"
+      }
+    ]
+  }
+}
+`)
+	status, body := serveRequest(debug, http.MethodGet, "/_routes?format=json&q=tenant")
+	is.Equal(status, http.StatusOK)
+	is.True(strings.Contains(body, `"query": "tenant"`))
+	is.True(!strings.Contains(body, "show_user"))
+}
+
+// pathValues responds with the route and the named path values
+func pathValues(route string, names ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := route
+		for _, name := range names {
+			body += " " + name + "=" + r.PathValue(name)
+		}
+		w.Write([]byte(body))
+	})
+}
+
+// serveRequest returns the status and body of the response to the request
+func serveRequest(h http.Handler, method, target string) (int, string) {
+	req := httptest.NewRequest(method, target, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+// discard is a response writer that discards the response
+type discard struct {
+	header http.Header
+}
+
+func (d *discard) Header() http.Header         { return d.header }
+func (d *discard) Write(p []byte) (int, error) { return len(p), nil }
+func (d *discard) WriteHeader(int)             {}
+
+func benchmark(b *testing.B, router http.Handler, method, path string) {
+	b.Helper()
+	w := &discard{header: http.Header{}}
+	r := httptest.NewRequest(method, path, nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func noop(w http.ResponseWriter, r *http.Request) {}
+
+func BenchmarkStatic(b *testing.B) {
+	router := mux.New()
+	router.Get("/", http.HandlerFunc(noop))
+	router.Get("/healthz", http.HandlerFunc(noop))
+	router.Get("/api/users", http.HandlerFunc(noop))
+	router.Get("/api/users/{id}", http.HandlerFunc(noop))
+	benchmark(b, router, http.MethodGet, "/api/users")
+}
+
+func BenchmarkStaticMiddleware(b *testing.B) {
+	router := mux.New()
+	router.Use(mux.Use(func(next http.Handler) http.Handler { return next }))
+	api := router.Group("/api")
+	api.Use(mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+		})
+	}))
+	api.Get("/users", http.HandlerFunc(noop))
+	api.Get("/users/{id}", http.HandlerFunc(noop))
+	benchmark(b, router, http.MethodGet, "/api/users")
+}
+
+func BenchmarkSlots(b *testing.B) {
+	router := mux.New()
+	router.Get("/api/users", http.HandlerFunc(noop))
+	router.Get("/api/users/{id}", http.HandlerFunc(noop))
+	router.Get("/api/users/{id}/posts/{post_id}", http.HandlerFunc(noop))
+	benchmark(b, router, http.MethodGet, "/api/users/10/posts/20")
+}
+
+func BenchmarkServeMuxStatic(b *testing.B) {
+	router := http.NewServeMux()
+	router.Handle("GET /{$}", http.HandlerFunc(noop))
+	router.Handle("GET /healthz", http.HandlerFunc(noop))
+	router.Handle("GET /api/users", http.HandlerFunc(noop))
+	router.Handle("GET /api/users/{id}", http.HandlerFunc(noop))
+	benchmark(b, router, http.MethodGet, "/api/users")
+}
+
+func BenchmarkServeMuxSlots(b *testing.B) {
+	router := http.NewServeMux()
+	router.Handle("GET /api/users", http.HandlerFunc(noop))
+	router.Handle("GET /api/users/{id}", http.HandlerFunc(noop))
+	router.Handle("GET /api/users/{id}/posts/{post_id}", http.HandlerFunc(noop))
+	benchmark(b, router, http.MethodGet, "/api/users/10/posts/20")
+}
+
+func BenchmarkNotFound(b *testing.B) {
+	router := mux.New()
+	router.Get("/api/users", http.HandlerFunc(noop))
+	router.Get("/api/users/{id}", http.HandlerFunc(noop))
+	benchmark(b, router, http.MethodGet, "/api/posts")
+}
+
+func BenchmarkServeMuxNotFound(b *testing.B) {
+	router := http.NewServeMux()
+	router.Handle("GET /api/users", http.HandlerFunc(noop))
+	router.Handle("GET /api/users/{id}", http.HandlerFunc(noop))
+	benchmark(b, router, http.MethodGet, "/api/posts")
+}
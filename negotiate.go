@@ -0,0 +1,127 @@
+package mux
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/matthewmueller/enroute"
+)
+
+// errNotAcceptable is returned when none of the handlers for a route produce a
+// media type the request accepts
+var errNotAcceptable = errors.New("not acceptable")
+
+// formatSlot is the slot whose extension is used in place of the Accept header
+// (e.g. /users/{id}.{format?})
+const formatSlot = "format"
+
+// Accept negotiates the handler for the route by media type. The route's
+// {format} slot takes precedence over the Accept header, so /users/10.json and
+// an Accept: application/json header resolve to the same handler. When the
+// request accepts none of the route's media types, the route registered
+// without Accept handles it, otherwise the response is 406 Not Acceptable.
+func (b *Builder) Accept(mediaTypes ...string) *Builder {
+	for _, mediaType := range mediaTypes {
+		mediaType, _, err := mime.ParseMediaType(mediaType)
+		if err != nil {
+			if b.err == nil {
+				b.err = err
+			}
+			return b
+		}
+		b.accept = append(b.accept, mediaType)
+	}
+	return b
+}
+
+// negotiate picks the handler that produces the media type the request
+// accepts most
+func (m *Match) negotiate(r *http.Request, entries []*entry, slots [][]*enroute.Slot) (*entry, []*enroute.Slot, error) {
+	ranges := acceptRanges(r, m.Slots)
+	var best *entry
+	var bestSlots []*enroute.Slot
+	bestQuality := 0.0
+	for i, entry := range entries {
+		for _, mediaType := range entry.accept {
+			if quality := quality(ranges, mediaType); quality > bestQuality {
+				best, bestSlots, bestQuality = entry, slots[i], quality
+				m.MediaType = mediaType
+			}
+		}
+	}
+	if best == nil {
+		return nil, nil, errNotAcceptable
+	}
+	return best, bestSlots, nil
+}
+
+// acceptRange is a media range from the Accept header
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+// acceptRanges returns the media ranges the request accepts. An extension in
+// the {format} slot takes precedence over the Accept header.
+func acceptRanges(r *http.Request, slots []*enroute.Slot) []acceptRange {
+	for _, slot := range slots {
+		if slot.Key != formatSlot || slot.Value == "" {
+			continue
+		}
+		mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension("." + slot.Value))
+		if err != nil {
+			return nil
+		}
+		return []acceptRange{{mediaType, 1}}
+	}
+	accept := r.Header.Values("Accept")
+	if len(accept) == 0 {
+		return []acceptRange{{"*/*", 1}}
+	}
+	return parseAccept(strings.Join(accept, ","))
+}
+
+// parseAccept parses the media ranges in an Accept header
+func parseAccept(accept string) (ranges []acceptRange) {
+	for part := range strings.SplitSeq(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType, quality})
+	}
+	return ranges
+}
+
+// quality returns the quality of the most specific media range matching the
+// media type, or 0 when the media type isn't acceptable
+func quality(ranges []acceptRange, mediaType string) float64 {
+	kind, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, r := range ranges {
+		var s int
+		switch {
+		case r.mediaType == mediaType:
+			s = 2
+		case r.mediaType == kind+"/*":
+			s = 1
+		case r.mediaType == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			quality, specificity = r.quality, s
+		}
+	}
+	return quality
+}
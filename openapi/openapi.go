@@ -0,0 +1,353 @@
+// Package openapi describes a router's routes as an OpenAPI 3.1 document, or
+// registers routes from an existing OpenAPI 3 document with Register.
+//
+// Slots become path parameters, with the regular expressions of regexp and
+// constrained slots (e.g. {id:int}) as patterns. Routes with optional or
+// wildcard slots are listed once for each path they match. Handlers created
+// with mux.JSON also describe their parameters, request body and response.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/livebud/mux"
+	"github.com/matthewmueller/enroute"
+	"github.com/matthewmueller/enroute/ast"
+)
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+// Info about the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path
+type PathItem struct {
+	Summary     string       `json:"summary,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Get         *Operation   `json:"get,omitempty"`
+	Put         *Operation   `json:"put,omitempty"`
+	Post        *Operation   `json:"post,omitempty"`
+	Delete      *Operation   `json:"delete,omitempty"`
+	Options     *Operation   `json:"options,omitempty"`
+	Head        *Operation   `json:"head,omitempty"`
+	Patch       *Operation   `json:"patch,omitempty"`
+	Trace       *Operation   `json:"trace,omitempty"`
+	Parameters  []*Parameter `json:"parameters,omitempty"`
+}
+
+// Operations returns the operations by method
+func (p *PathItem) Operations() map[string]*Operation {
+	operations := map[string]*Operation{}
+	for method, operation := range p.operations() {
+		if *operation != nil {
+			operations[method] = *operation
+		}
+	}
+	return operations
+}
+
+// operations returns pointers to the operation fields by method
+func (p *PathItem) operations() map[string]**Operation {
+	return map[string]**Operation{
+		http.MethodGet:     &p.Get,
+		http.MethodPut:     &p.Put,
+		http.MethodPost:    &p.Post,
+		http.MethodDelete:  &p.Delete,
+		http.MethodOptions: &p.Options,
+		http.MethodHead:    &p.Head,
+		http.MethodPatch:   &p.Patch,
+		http.MethodTrace:   &p.Trace,
+	}
+}
+
+// Operation on a path
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter of an operation
+type Parameter struct {
+	Ref         string  `json:"$ref,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	In          string  `json:"in,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody of an operation
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// Response of an operation
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes the content of a body
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components holds the schemas and parameters referenced by the document
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas,omitempty"`
+	Parameters map[string]*Parameter `json:"parameters,omitempty"`
+}
+
+// Config for serving the document
+type Config struct {
+	Info Info
+	// Path to serve the document at. Defaults to /openapi.json.
+	Path string
+}
+
+// New document that's generated from the router's routes on every request,
+// so it stays in sync as routes change. Mount it on the router to serve it at
+// the configured path.
+func New(router *mux.Router, config Config) *Spec {
+	if config.Path == "" {
+		config.Path = "/openapi.json"
+	}
+	return &Spec{router, config}
+}
+
+// Spec serves the document generated from the router's routes
+type Spec struct {
+	router *mux.Router
+	config Config
+}
+
+var _ mux.Mountable = (*Spec)(nil)
+var _ http.Handler = (*Spec)(nil)
+
+// Mount the document at the configured path
+func (s *Spec) Mount(routes mux.Routes) {
+	routes.Get(s.config.Path, s)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Spec) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := json.MarshalIndent(Generate(s.router, s.config.Info), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
+
+// typed handlers describe their input and output types
+type typed interface {
+	Types() (in, out reflect.Type)
+}
+
+// Generate an OpenAPI document from the router's routes. Routes scoped to a
+// host, automatic HEAD and OPTIONS responses and the routes serving the
+// document aren't included.
+func Generate(router *mux.Router, info Info) *Document {
+	g := &generator{
+		doc: &Document{
+			OpenAPI: "3.1.0",
+			Info:    info,
+			Paths:   map[string]*PathItem{},
+		},
+		names: map[reflect.Type]string{},
+	}
+	// Routes with optional and wildcard slots are listed once per expansion
+	var routes []*mux.Route
+	seen := map[string]bool{}
+	for _, route := range router.Routes() {
+		if key := route.String() + " " + strings.Join(route.Matchers, " "); !seen[key] {
+			seen[key] = true
+			routes = append(routes, route)
+		}
+	}
+	// Count the methods sharing a name, so operation IDs stay unique
+	named := map[string]int{}
+	for _, route := range routes {
+		if route.Name != "" && route.Host == "" && len(route.Matchers) == 0 {
+			named[route.Name]++
+		}
+	}
+	for _, route := range routes {
+		if _, ok := route.Handler.(*Spec); ok || route.Host != "" {
+			continue
+		}
+		id := route.Name
+		if named[route.Name] > 1 {
+			id = route.Name + "." + strings.ToLower(route.Method)
+		}
+		g.add(route, id)
+	}
+	return g.doc
+}
+
+type generator struct {
+	doc   *Document
+	names map[reflect.Type]string // component names of the named types
+}
+
+// add the route's operations to the document
+func (g *generator) add(route *mux.Route, id string) {
+	parsed, err := enroute.Parse(route.Regexp())
+	if err != nil {
+		return
+	}
+	// Routes with optional and wildcard slots match more than one path
+	expanded := parsed.Expand()
+	for i, r := range expanded {
+		path, params := pathOf(r)
+		item, ok := g.doc.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			g.doc.Paths[path] = item
+		}
+		field, ok := item.operations()[route.Method]
+		if !ok || *field != nil {
+			// The first handler of routes with request matchers is listed
+			continue
+		}
+		operation := &Operation{
+			Parameters: params,
+			Responses: map[string]*Response{
+				"default": {Description: "Response"},
+			},
+		}
+		// Operation IDs need to be unique, so only the full path gets one
+		if i == len(expanded)-1 {
+			operation.OperationID = id
+		}
+		if handler, ok := route.Handler.(typed); ok {
+			in, out := handler.Types()
+			g.describe(operation, route.Method, in, out)
+		}
+		*field = operation
+	}
+}
+
+// pathOf converts the route into an OpenAPI path and its parameters
+func pathOf(route *ast.Route) (string, []*Parameter) {
+	var path strings.Builder
+	var params []*Parameter
+	for _, section := range route.Sections {
+		slot, ok := section.(ast.Slot)
+		if !ok {
+			path.WriteString(section.String())
+			continue
+		}
+		param := &Parameter{
+			Name:     slot.Slot(),
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: Type{"string"}},
+		}
+		switch s := section.(type) {
+		case *ast.RegexpSlot:
+			param.Schema.Pattern = s.Pattern.String()
+		case *ast.WildcardSlot:
+			param.Description = "Matches the rest of the path, including slashes"
+		}
+		path.WriteString("{" + param.Name + "}")
+		params = append(params, param)
+	}
+	return path.String(), params
+}
+
+// describe the operation's parameters, request body and response from the
+// types of a typed handler
+func (g *generator) describe(operation *Operation, method string, in, out reflect.Type) {
+	if in.Kind() == reflect.Pointer {
+		in = in.Elem()
+	}
+	if in.Kind() == reflect.Struct {
+		for i := range in.NumField() {
+			field := in.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if key, _, ok := cutTag(field, "path"); ok {
+				for _, param := range operation.Parameters {
+					if param.Name == key {
+						param.Schema = withPattern(g.schemaOf(field.Type), param.Schema.Pattern)
+					}
+				}
+			}
+			if key, options, ok := cutTag(field, "query"); ok {
+				operation.Parameters = append(operation.Parameters, &Parameter{
+					Name:     key,
+					In:       "query",
+					Required: slices.Contains(options, "required"),
+					Schema:   g.schemaOf(field.Type),
+				})
+			}
+		}
+	}
+	if method != http.MethodGet && method != http.MethodHead {
+		if schema := g.bodyOf(in); schema != nil {
+			operation.RequestBody = &RequestBody{
+				Content: map[string]*MediaType{
+					"application/json": {Schema: schema},
+				},
+			}
+		}
+	}
+	operation.Responses = map[string]*Response{
+		"200": {
+			Description: "OK",
+			Content: map[string]*MediaType{
+				"application/json": {Schema: g.schemaOf(out)},
+			},
+		},
+	}
+}
+
+// withPattern adds the slot's pattern to string schemas
+func withPattern(schema *Schema, pattern string) *Schema {
+	if pattern == "" || !slices.Equal(schema.Type, Type{"string"}) || schema.Ref != "" {
+		return schema
+	}
+	copy := *schema
+	copy.Pattern = pattern
+	return &copy
+}
+
+// cutTag returns the key and options of the field's tag. The key defaults to
+// the field's name.
+func cutTag(field reflect.StructField, name string) (key string, options []string, ok bool) {
+	tag, ok := field.Tag.Lookup(name)
+	if !ok {
+		return "", nil, false
+	}
+	parts := strings.Split(tag, ",")
+	if parts[0] == "-" {
+		return "", nil, false
+	}
+	if parts[0] == "" {
+		parts[0] = field.Name
+	}
+	return parts[0], parts[1:], true
+}
@@ -0,0 +1,605 @@
+package openapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livebud/mux"
+	"github.com/livebud/mux/openapi"
+	"github.com/matryer/is"
+	"github.com/matthewmueller/diff"
+)
+
+func handler(route string) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(route))
+	})
+}
+
+func encode(t testing.TB, v any) string {
+	t.Helper()
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+type showUser struct {
+	ID     int      `path:"id"`
+	Fields []string `query:"fields"`
+	Page   *int     `query:"page,required"`
+}
+
+type createUser struct {
+	Org   string `path:"org"`
+	Name  string `json:"name,required"`
+	Email string `json:"email"`
+}
+
+type user struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Manager   *user     `json:"manager,omitempty"`
+}
+
+func TestPaths(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/", handler("GET /")))
+	is.NoErr(router.Get("/users/{id}", handler("GET /users/{id}")))
+	is.NoErr(router.Get("/posts/{slug:slug}", handler("GET /posts/{slug:slug}")))
+	is.NoErr(router.Get("/archive/{year|[0-9]{4}}/{month?}", handler("GET /archive")))
+	is.NoErr(router.Get("/files/{path*}", handler("GET /files/{path*}")))
+	is.NoErr(router.Host("admin.example.com").Get("/stats", handler("GET /stats")))
+	doc := openapi.Generate(router, openapi.Info{Title: "Example", Version: "1.0.0"})
+	diff.TestContent(t, encode(t, doc), `
+		{
+		  "openapi": "3.1.0",
+		  "info": {
+		    "title": "Example",
+		    "version": "1.0.0"
+		  },
+		  "paths": {
+		    "/": {
+		      "get": {
+		        "responses": {
+		          "default": {
+		            "description": "Response"
+		          }
+		        }
+		      }
+		    },
+		    "/archive/{year}": {
+		      "get": {
+		        "parameters": [
+		          {
+		            "name": "year",
+		            "in": "path",
+		            "required": true,
+		            "schema": {
+		              "type": "string",
+		              "pattern": "^[0-9]{4}$"
+		            }
+		          }
+		        ],
+		        "responses": {
+		          "default": {
+		            "description": "Response"
+		          }
+		        }
+		      }
+		    },
+		    "/archive/{year}/{month}": {
+		      "get": {
+		        "parameters": [
+		          {
+		            "name": "year",
+		            "in": "path",
+		            "required": true,
+		            "schema": {
+		              "type": "string",
+		              "pattern": "^[0-9]{4}$"
+		            }
+		          },
+		          {
+		            "name": "month",
+		            "in": "path",
+		            "required": true,
+		            "schema": {
+		              "type": "string"
+		            }
+		          }
+		        ],
+		        "responses": {
+		          "default": {
+		            "description": "Response"
+		          }
+		        }
+		      }
+		    },
+		    "/files": {
+		      "get": {
+		        "responses": {
+		          "default": {
+		            "description": "Response"
+		          }
+		        }
+		      }
+		    },
+		    "/files/{path}": {
+		      "get": {
+		        "parameters": [
+		          {
+		            "name": "path",
+		            "in": "path",
+		            "description": "Matches the rest of the path, including slashes",
+		            "required": true,
+		            "schema": {
+		              "type": "string"
+		            }
+		          }
+		        ],
+		        "responses": {
+		          "default": {
+		            "description": "Response"
+		          }
+		        }
+		      }
+		    },
+		    "/posts/{slug}": {
+		      "get": {
+		        "parameters": [
+		          {
+		            "name": "slug",
+		            "in": "path",
+		            "required": true,
+		            "schema": {
+		              "type": "string",
+		              "pattern": "^[a-zA-Z0-9]+(?:-[a-zA-Z0-9]+)*$"
+		            }
+		          }
+		        ],
+		        "responses": {
+		          "default": {
+		            "description": "Response"
+		          }
+		        }
+		      }
+		    },
+		    "/users/{id}": {
+		      "get": {
+		        "parameters": [
+		          {
+		            "name": "id",
+		            "in": "path",
+		            "required": true,
+		            "schema": {
+		              "type": "string"
+		            }
+		          }
+		        ],
+		        "responses": {
+		          "default": {
+		            "description": "Response"
+		          }
+		        }
+		      }
+		    }
+		  }
+		}
+	`)
+}
+
+func TestOperationIDs(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Name("users").Get("/users", handler("GET /users")))
+	is.NoErr(router.Name("users").Post("/users", handler("POST /users")))
+	is.NoErr(router.Name("user").Get("/users/{id}", handler("GET /users/{id}")))
+	is.NoErr(router.Name("posts").Get("/posts/{id?}", handler("GET /posts/{id?}")))
+	doc := openapi.Generate(router, openapi.Info{Title: "Example", Version: "1.0.0"})
+	is.Equal(doc.Paths["/users"].Get.OperationID, "users.get")
+	is.Equal(doc.Paths["/users"].Post.OperationID, "users.post")
+	is.Equal(doc.Paths["/users/{id}"].Get.OperationID, "user")
+	// Only the full path of a route with an optional slot gets the ID
+	is.Equal(doc.Paths["/posts"].Get.OperationID, "")
+	is.Equal(doc.Paths["/posts/{id}"].Get.OperationID, "posts")
+}
+
+func TestTyped(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Get("/users/{id:int}", mux.JSON(func(ctx context.Context, in showUser) (*user, error) {
+		return &user{ID: in.ID}, nil
+	})))
+	is.NoErr(router.Post("/orgs/{org}/users", mux.JSON(func(ctx context.Context, in *createUser) ([]*user, error) {
+		return nil, nil
+	})))
+	doc := openapi.Generate(router, openapi.Info{Title: "Example", Version: "1.0.0"})
+	diff.TestContent(t, encode(t, doc.Paths["/users/{id}"]), `
+		{
+		  "get": {
+		    "parameters": [
+		      {
+		        "name": "id",
+		        "in": "path",
+		        "required": true,
+		        "schema": {
+		          "type": "integer"
+		        }
+		      },
+		      {
+		        "name": "fields",
+		        "in": "query",
+		        "schema": {
+		          "type": "array",
+		          "items": {
+		            "type": "string"
+		          }
+		        }
+		      },
+		      {
+		        "name": "page",
+		        "in": "query",
+		        "required": true,
+		        "schema": {
+		          "type": [
+		            "integer",
+		            "null"
+		          ]
+		        }
+		      }
+		    ],
+		    "responses": {
+		      "200": {
+		        "description": "OK",
+		        "content": {
+		          "application/json": {
+		            "schema": {
+		              "$ref": "#/components/schemas/user"
+		            }
+		          }
+		        }
+		      }
+		    }
+		  }
+		}
+	`)
+	diff.TestContent(t, encode(t, doc.Paths["/orgs/{org}/users"]), `
+		{
+		  "post": {
+		    "parameters": [
+		      {
+		        "name": "org",
+		        "in": "path",
+		        "required": true,
+		        "schema": {
+		          "type": "string"
+		        }
+		      }
+		    ],
+		    "requestBody": {
+		      "content": {
+		        "application/json": {
+		          "schema": {
+		            "type": "object",
+		            "properties": {
+		              "email": {
+		                "type": "string"
+		              },
+		              "name": {
+		                "type": "string"
+		              }
+		            },
+		            "required": [
+		              "name"
+		            ]
+		          }
+		        }
+		      }
+		    },
+		    "responses": {
+		      "200": {
+		        "description": "OK",
+		        "content": {
+		          "application/json": {
+		            "schema": {
+		              "type": "array",
+		              "items": {
+		                "$ref": "#/components/schemas/user"
+		              }
+		            }
+		          }
+		        }
+		      }
+		    }
+		  }
+		}
+	`)
+	diff.TestContent(t, encode(t, doc.Components), `
+		{
+		  "schemas": {
+		    "user": {
+		      "type": "object",
+		      "properties": {
+		        "created_at": {
+		          "type": "string",
+		          "format": "date-time"
+		        },
+		        "email": {
+		          "type": [
+		            "string",
+		            "null"
+		          ]
+		        },
+		        "id": {
+		          "type": "integer"
+		        },
+		        "manager": {
+		          "$ref": "#/components/schemas/user"
+		        },
+		        "name": {
+		          "type": "string"
+		        }
+		      }
+		    }
+		  }
+		}
+	`)
+}
+
+func TestServe(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Mount(openapi.New(router, openapi.Config{
+		Info: openapi.Info{Title: "Example", Version: "1.0.0"},
+		Path: "/docs/openapi.json",
+	}))
+	is.NoErr(router.Get("/users/{id}", handler("GET /users/{id}")))
+	req := httptest.NewRequest(http.MethodGet, "/docs/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Header().Get("Content-Type"), "application/json")
+	var doc openapi.Document
+	is.NoErr(json.Unmarshal(rec.Body.Bytes(), &doc))
+	is.Equal(doc.Info.Title, "Example")
+	// The document doesn't describe itself
+	is.Equal(len(doc.Paths), 1)
+	is.True(doc.Paths["/users/{id}"].Get != nil)
+	// Routes added later are included
+	is.NoErr(router.Post("/users", handler("POST /users")))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.NoErr(json.Unmarshal(rec.Body.Bytes(), &doc))
+	is.Equal(len(doc.Paths), 2)
+}
+
+func TestDefaultPath(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	router.Mount(openapi.New(router, openapi.Config{
+		Info: openapi.Info{Title: "Example", Version: "1.0.0"},
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusOK)
+}
+
+const petstore = `{
+  "openapi": "3.1.0",
+  "info": {"title": "Petstore", "version": "1.0.0"},
+  "paths": {
+    "/pets": {
+      "get": {
+        "operationId": "listPets",
+        "parameters": [
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 100}},
+          {"name": "sort", "in": "query", "schema": {"type": "string", "enum": ["name", "age"]}},
+          {"name": "tag", "in": "query", "schema": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}}}
+        ],
+        "responses": {"200": {"description": "OK"}}
+      },
+      "post": {
+        "operationId": "createPet",
+        "parameters": [
+          {"name": "X-Request-Id", "in": "header", "required": true, "schema": {"type": "string", "format": "uuid"}}
+        ],
+        "responses": {"201": {"description": "Created"}}
+      }
+    },
+    "/pets/{petId}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/petId"}
+      ],
+      "get": {
+        "operationId": "showPet",
+        "responses": {"200": {"description": "OK"}}
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "petId": {"name": "petId", "in": "path", "required": true, "schema": {"$ref": "#/components/schemas/id"}}
+    },
+    "schemas": {
+      "id": {"type": "integer", "format": "int64"}
+    }
+  }
+}`
+
+func TestRegister(t *testing.T) {
+	is := is.New(t)
+	doc, err := openapi.Parse([]byte(petstore))
+	is.NoErr(err)
+	router := mux.New()
+	err = openapi.Register(router.Group("/api", mux.API()), doc, map[string]http.Handler{
+		"listPets":  handler("listPets"),
+		"createPet": handler("createPet"),
+		"showPet": mux.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			if r.PathValue("petId") == "404" {
+				return &mux.StatusError{Status: http.StatusNotFound}
+			}
+			w.Write([]byte("showPet " + r.PathValue("petId")))
+			return nil
+		}),
+	})
+	is.NoErr(err)
+	serve := func(method, target string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := serve(http.MethodGet, "/api/pets?limit=10&sort=age&tag=cat&tag=dog")
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Body.String(), "listPets")
+	rec = serve(http.MethodGet, "/api/pets?limit=1000&sort=color&tag=Cat")
+	is.Equal(rec.Code, http.StatusBadRequest)
+	is.Equal(rec.Header().Get("Content-Type"), "application/problem+json")
+	is.Equal(rec.Body.String(), `{"type":"about:blank","title":"Bad Request","status":400,"detail":"openapi: query \"limit\" must be at most 100, query \"sort\" must be one of name, age, query \"tag\" must match \"^[a-z]+$\"","instance":"/api/pets"}`+"\n")
+	rec = serve(http.MethodPost, "/api/pets")
+	is.Equal(rec.Code, http.StatusBadRequest)
+	is.True(strings.Contains(rec.Body.String(), `header \"X-Request-Id\" is required`))
+	rec = serve(http.MethodPost, "/api/pets", "X-Request-Id", "3b241101-e2bb-4255-8caf-4136c566a962")
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Body.String(), "createPet")
+	rec = serve(http.MethodGet, "/api/pets/10")
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Body.String(), "showPet 10")
+	rec = serve(http.MethodGet, "/api/pets/ten")
+	is.Equal(rec.Code, http.StatusBadRequest)
+	is.True(strings.Contains(rec.Body.String(), `path \"petId\" is not a valid integer`))
+	// Errors returned by handlers are written by the group's error handler
+	rec = serve(http.MethodGet, "/api/pets/404")
+	is.Equal(rec.Code, http.StatusNotFound)
+	is.Equal(rec.Header().Get("Content-Type"), "application/problem+json")
+	// Operations are named by their operationId
+	url, err := router.URL("showPet", "pet_id", "10")
+	is.NoErr(err)
+	is.Equal(url, "/api/pets/10")
+}
+
+func TestRegisterMismatch(t *testing.T) {
+	is := is.New(t)
+	doc, err := openapi.Parse([]byte(petstore))
+	is.NoErr(err)
+	router := mux.New()
+	err = openapi.Register(router, doc, map[string]http.Handler{
+		"listPets":  handler("listPets"),
+		"deletePet": handler("deletePet"),
+	})
+	is.True(err != nil)
+	is.Equal(err.Error(), strings.Join([]string{
+		`openapi: no handler for operation "createPet" (POST /pets)`,
+		`openapi: no handler for operation "showPet" (GET /pets/{petId})`,
+		`openapi: no operation for handler "deletePet"`,
+	}, "\n"))
+	// Nothing is registered
+	is.Equal(len(router.Routes()), 0)
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	is := is.New(t)
+	doc, err := openapi.Parse([]byte(petstore))
+	is.NoErr(err)
+	router := mux.New()
+	is.NoErr(router.Route(http.MethodGet, "/pets").Header("X-Beta", "1").Handler(handler("beta")))
+	is.NoErr(router.Get("/pets/{id}", handler("existing")))
+	err = openapi.Register(router, doc, map[string]http.Handler{
+		"listPets":  handler("listPets"),
+		"createPet": handler("createPet"),
+		"showPet":   handler("showPet"),
+	})
+	is.True(err != nil)
+	is.True(errors.Is(err, mux.ErrDuplicate))
+	// Nothing is registered and the existing routes are kept
+	routes := router.Routes()
+	is.Equal(len(routes), 2)
+	is.Equal(routes[0].String(), "GET /pets")
+	is.Equal(routes[0].Matchers, []string{"header X-Beta=1"})
+	is.Equal(routes[1].String(), "GET /pets/{id}")
+	_, err = router.URL("listPets")
+	is.True(err != nil)
+	req := httptest.NewRequest(http.MethodGet, "/pets", nil)
+	req.Header.Set("X-Beta", "1")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Body.String(), "beta")
+	req = httptest.NewRequest(http.MethodGet, "/pets", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNotFound)
+}
+
+func TestRegisterAcronym(t *testing.T) {
+	is := is.New(t)
+	doc, err := openapi.Parse([]byte(strings.ReplaceAll(petstore, "petId", "petID")))
+	is.NoErr(err)
+	router := mux.New()
+	err = openapi.Register(router, doc, map[string]http.Handler{
+		"listPets":  handler("listPets"),
+		"createPet": handler("createPet"),
+		"showPet": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("showPet " + r.PathValue("petID") + " " + r.PathValue("pet_id")))
+		}),
+	})
+	is.NoErr(err)
+	route, err := router.Find(http.MethodGet, "/pets/{pet_id}")
+	is.NoErr(err)
+	is.Equal(route.Route, "/pets/{pet_id}")
+	url, err := router.URL("showPet", "pet_id", "10")
+	is.NoErr(err)
+	is.Equal(url, "/pets/10")
+	req := httptest.NewRequest(http.MethodGet, "/pets/10", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Body.String(), "showPet 10 10")
+}
+
+func TestRegisterGenerated(t *testing.T) {
+	is := is.New(t)
+	router := mux.New()
+	is.NoErr(router.Name("showUser").Get("/users/{id:int}", mux.JSON(func(ctx context.Context, in showUser) (*user, error) {
+		return &user{ID: in.ID}, nil
+	})))
+	doc := openapi.Generate(router, openapi.Info{Title: "Example", Version: "1.0.0"})
+	data, err := json.Marshal(doc)
+	is.NoErr(err)
+	doc, err = openapi.Parse(data)
+	is.NoErr(err)
+	other := mux.New()
+	is.NoErr(openapi.Register(other, doc, map[string]http.Handler{
+		"showUser": handler("showUser"),
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/users/10?page=1", nil)
+	rec := httptest.NewRecorder()
+	other.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusOK)
+	req = httptest.NewRequest(http.MethodGet, "/users/10", nil)
+	rec = httptest.NewRecorder()
+	other.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusBadRequest)
+	is.Equal(rec.Body.String(), "openapi: query \"page\" is required\n")
+}
+
+func TestParseVersion(t *testing.T) {
+	is := is.New(t)
+	_, err := openapi.Parse([]byte(`{"swagger": "2.0"}`))
+	is.True(err != nil)
+	is.Equal(err.Error(), `openapi: unsupported version "", expected 3.x`)
+}
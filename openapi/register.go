@@ -0,0 +1,407 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/livebud/mux"
+	"github.com/livebud/mux/internal/snake"
+)
+
+// Parse an OpenAPI 3 document encoded as JSON
+func Parse(data []byte) (*Document, error) {
+	doc := new(Document)
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("openapi: unable to parse the document. %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("openapi: unsupported version %q, expected 3.x", doc.OpenAPI)
+	}
+	return doc, nil
+}
+
+// methods in the order operations are registered
+var methods = []string{
+	http.MethodGet,
+	http.MethodPut,
+	http.MethodPost,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodHead,
+	http.MethodPatch,
+	http.MethodTrace,
+}
+
+// Register the document's operations on the router, using the handler with the
+// operation's operationId. Operations are named by their operationId, so their
+// URLs can be built with router.URL.
+//
+// Path parameters are renamed to the snake_case slots the router supports,
+// e.g. {petId} becomes {pet_id}. Handlers can read them by either name, while
+// URLs are built with the slot names.
+//
+// Requests are validated against the operation's parameters before the handler
+// runs. Invalid requests are 400 Bad Request errors written by the router's
+// error handler.
+//
+// Nothing is registered if an operation has no handler, a handler has no
+// operation, a parameter can't be resolved or the router rejects a route.
+func Register(router *mux.Router, doc *Document, handlers map[string]http.Handler) error {
+	var operations []*operation
+	var errs []error
+	used := map[string]bool{}
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		item := doc.Paths[path]
+		fields := item.operations()
+		for _, method := range methods {
+			op := *fields[method]
+			if op == nil {
+				continue
+			}
+			if op.OperationID == "" {
+				errs = append(errs, fmt.Errorf("openapi: %s %s has no operationId", method, path))
+				continue
+			}
+			handler, ok := handlers[op.OperationID]
+			if !ok {
+				errs = append(errs, fmt.Errorf("openapi: no handler for operation %q (%s %s)", op.OperationID, method, path))
+				continue
+			}
+			used[op.OperationID] = true
+			params, err := doc.parameters(item.Parameters, op.Parameters)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("openapi: unable to register operation %q. %w", op.OperationID, err))
+				continue
+			}
+			route, renamed := routeOf(path)
+			operations = append(operations, &operation{method, route, op.OperationID, params, renamed, handler})
+		}
+	}
+	ids := make([]string, 0, len(handlers))
+	for id := range handlers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !used[id] {
+			errs = append(errs, fmt.Errorf("openapi: no operation for handler %q", id))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return router.Batch(func(batch *mux.Router) error {
+		for _, op := range operations {
+			if err := batch.Name(op.id).Set(op.method, op.route, op.handle()); err != nil {
+				return fmt.Errorf("openapi: unable to register operation %q. %w", op.id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// operation bound to its handler
+type operation struct {
+	method  string
+	route   string
+	id      string
+	params  []*param
+	renamed map[string]string // slot => path parameter
+	handler http.Handler
+}
+
+// routeOf converts the path's parameters into slots the router supports
+func routeOf(path string) (route string, renamed map[string]string) {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(path, '{')
+		end := strings.IndexByte(path, '}')
+		if start < 0 || end < start {
+			b.WriteString(path)
+			return b.String(), renamed
+		}
+		name := path[start+1 : end]
+		slot := snake.Case(name)
+		if slot != name {
+			if renamed == nil {
+				renamed = map[string]string{}
+			}
+			renamed[slot] = name
+		}
+		b.WriteString(path[:start] + "{" + slot + "}")
+		path = path[end+1:]
+	}
+}
+
+// handle validates the request before calling the handler
+func (op *operation) handle() mux.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		for slot, name := range op.renamed {
+			r.SetPathValue(name, r.PathValue(slot))
+		}
+		if err := op.validate(r); err != nil {
+			return err
+		}
+		return mux.Serve(w, r, op.handler)
+	}
+}
+
+// validate the request's parameters
+func (op *operation) validate(r *http.Request) error {
+	var query url.Values
+	var problems []string
+	for _, p := range op.params {
+		var values []string
+		switch p.in {
+		case "path":
+			if value := r.PathValue(p.name); value != "" {
+				values = []string{value}
+			}
+		case "query":
+			if query == nil {
+				query = r.URL.Query()
+			}
+			values = query[p.name]
+		case "header":
+			values = r.Header.Values(p.name)
+		case "cookie":
+			if cookie, err := r.Cookie(p.name); err == nil {
+				values = []string{cookie.Value}
+			}
+		}
+		if len(values) == 0 {
+			if p.required {
+				problems = append(problems, fmt.Sprintf("%s %q is required", p.in, p.name))
+			}
+			continue
+		}
+		// Arrays outside of the query are comma-separated
+		if p.in != "query" && p.rule.is("array") {
+			values = strings.Split(values[0], ",")
+		}
+		if problem := p.rule.check(values); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s %q %s", p.in, p.name, problem))
+		}
+	}
+	if len(problems) > 0 {
+		return &mux.StatusError{
+			Status: http.StatusBadRequest,
+			Err:    fmt.Errorf("openapi: %s", strings.Join(problems, ", ")),
+		}
+	}
+	return nil
+}
+
+// param is a resolved parameter
+type param struct {
+	name     string
+	in       string
+	required bool
+	rule     *rule
+}
+
+// parameters resolves the path's and operation's parameters. Operation
+// parameters override path parameters with the same name and location.
+func (d *Document) parameters(shared, own []*Parameter) (params []*param, err error) {
+	index := map[string]int{}
+	for _, p := range append(slices.Clone(shared), own...) {
+		p, err := d.parameter(p)
+		if err != nil {
+			return nil, err
+		}
+		rule, err := d.rule(p.Schema, map[string]bool{})
+		if err != nil {
+			return nil, fmt.Errorf("%s parameter %q: %w", p.In, p.Name, err)
+		}
+		resolved := &param{
+			name:     p.Name,
+			in:       p.In,
+			required: p.Required || p.In == "path",
+			rule:     rule,
+		}
+		key := p.In + " " + p.Name
+		if i, ok := index[key]; ok {
+			params[i] = resolved
+			continue
+		}
+		index[key] = len(params)
+		params = append(params, resolved)
+	}
+	return params, nil
+}
+
+// parameter resolves a reference to a parameter in the components
+func (d *Document) parameter(p *Parameter) (*Parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/")
+	if !ok || d.Components == nil || d.Components.Parameters[name] == nil {
+		return nil, fmt.Errorf("unable to resolve parameter %q", p.Ref)
+	}
+	return d.Components.Parameters[name], nil
+}
+
+// rule compiles the schema, resolving references to schemas in the components
+func (d *Document) rule(schema *Schema, seen map[string]bool) (*rule, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	for schema.Ref != "" {
+		if seen[schema.Ref] {
+			return nil, fmt.Errorf("schema %q refers to itself", schema.Ref)
+		}
+		seen[schema.Ref] = true
+		name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/")
+		if !ok || d.Components == nil || d.Components.Schemas[name] == nil {
+			return nil, fmt.Errorf("unable to resolve schema %q", schema.Ref)
+		}
+		schema = d.Components.Schemas[name]
+	}
+	r := &rule{schema: schema}
+	if schema.Pattern != "" {
+		pattern, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q. %w", schema.Pattern, err)
+		}
+		r.pattern = pattern
+	}
+	if schema.Items != nil {
+		items, err := d.rule(schema.Items, seen)
+		if err != nil {
+			return nil, err
+		}
+		r.items = items
+	}
+	return r, nil
+}
+
+// rule validates parameter values against a schema
+type rule struct {
+	schema  *Schema
+	pattern *regexp.Regexp
+	items   *rule
+}
+
+var uuid = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// is returns true if the schema has the type
+func (r *rule) is(kind string) bool {
+	return r != nil && slices.Contains(r.schema.Type, kind)
+}
+
+// check the values, returning the problem or an empty string if they're valid
+func (r *rule) check(values []string) string {
+	if r == nil {
+		return ""
+	}
+	if !r.is("array") {
+		return r.checkValue(values[0])
+	}
+	for _, value := range values {
+		if problem := r.items.check([]string{value}); problem != "" {
+			return problem
+		}
+	}
+	return ""
+}
+
+// checkValue checks a single value
+func (r *rule) checkValue(value string) string {
+	schema := r.schema
+	types := slices.DeleteFunc(slices.Clone(schema.Type), func(kind string) bool {
+		return kind == "null"
+	})
+	if len(types) > 0 && !slices.ContainsFunc(types, func(kind string) bool { return parses(kind, value) }) {
+		return "is not a valid " + strings.Join(types, " or ")
+	}
+	if len(schema.Enum) > 0 {
+		options := make([]string, len(schema.Enum))
+		for i, option := range schema.Enum {
+			options[i] = fmt.Sprint(option)
+		}
+		if !slices.Contains(options, value) {
+			return "must be one of " + strings.Join(options, ", ")
+		}
+	}
+	if n, err := strconv.ParseFloat(value, 64); err == nil && (r.is("integer") || r.is("number")) {
+		if schema.Minimum != nil && n < *schema.Minimum {
+			return fmt.Sprintf("must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && n > *schema.Maximum {
+			return fmt.Sprintf("must be at most %v", *schema.Maximum)
+		}
+	}
+	length := utf8.RuneCountInString(value)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		return fmt.Sprintf("must be at least %d characters", *schema.MinLength)
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		return fmt.Sprintf("must be at most %d characters", *schema.MaxLength)
+	}
+	if r.pattern != nil && !r.pattern.MatchString(value) {
+		return fmt.Sprintf("must match %q", schema.Pattern)
+	}
+	if !formats(schema.Format, value) {
+		return "is not a valid " + schema.Format
+	}
+	return ""
+}
+
+// parses returns true if the value parses as the type
+func parses(kind, value string) bool {
+	switch kind {
+	case "integer":
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case "number":
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	case "boolean":
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	case "string":
+		return true
+	default:
+		// Objects and arrays of arrays aren't checked
+		return kind == "object" || kind == "array"
+	}
+}
+
+// formats returns true if the value has the format. Unknown formats are
+// allowed.
+func formats(format, value string) bool {
+	switch format {
+	case "int32":
+		_, err := strconv.ParseInt(value, 10, 32)
+		return err == nil
+	case "int64":
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "uuid":
+		return uuid.MatchString(value)
+	default:
+		return true
+	}
+}
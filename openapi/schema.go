@@ -0,0 +1,218 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON schema
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 Type               `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Type of a schema. A single type is encoded as a string and multiple types
+// as an array, e.g. ["string", "null"].
+type Type []string
+
+// MarshalJSON implements json.Marshaler
+func (t Type) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *Type) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = Type{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("openapi: schema type must be a string or an array of strings. %w", err)
+	}
+	*t = many
+	return nil
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	textMarshaler     = reflect.TypeFor[encoding.TextMarshaler]()
+	jsonMarshaler     = reflect.TypeFor[json.Marshaler]()
+	invalidComponents = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+)
+
+// schemaOf returns the schema of the type as encoded by encoding/json. Named
+// structs are added to the components and referenced.
+func (g *generator) schemaOf(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		schema := g.schemaOf(t.Elem())
+		if schema.Ref != "" || len(schema.Type) == 0 {
+			return schema
+		}
+		nullable := *schema
+		nullable.Type = append(Type{}, schema.Type...)
+		nullable.Type = append(nullable.Type, "null")
+		return &nullable
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: Type{"string"}, Format: "date-time"}
+	case t.Implements(jsonMarshaler) || reflect.PointerTo(t).Implements(jsonMarshaler):
+		// Custom encodings could be anything
+		return &Schema{}
+	case t.Implements(textMarshaler) || reflect.PointerTo(t).Implements(textMarshaler):
+		return &Schema{Type: Type{"string"}}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Type{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: Type{"integer"}}
+	case reflect.Int32, reflect.Uint32:
+		return &Schema{Type: Type{"integer"}, Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: Type{"integer"}, Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: Type{"number"}, Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: Type{"number"}, Format: "double"}
+	case reflect.String:
+		return &Schema{Type: Type{"string"}}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// Encoded as base64
+			return &Schema{Type: Type{"string"}, Format: "byte"}
+		}
+		return &Schema{Type: Type{"array"}, Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: Type{"object"}, AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.objectOf(t, nil)
+		}
+		return g.refOf(t)
+	default:
+		// Interfaces can hold any value
+		return &Schema{}
+	}
+}
+
+// refOf adds the named struct to the components and returns a reference
+func (g *generator) refOf(t reflect.Type) *Schema {
+	if name, ok := g.names[t]; ok {
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	if g.doc.Components == nil {
+		g.doc.Components = &Components{Schemas: map[string]*Schema{}}
+	}
+	schemas := g.doc.Components.Schemas
+	// Generic type names contain brackets and types from different packages
+	// can share a name
+	base := invalidComponents.ReplaceAllString(t.Name(), "_")
+	name := base
+	for i := 2; schemas[name] != nil; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	// Reserve the name first, so recursive types reference themselves
+	g.names[t] = name
+	schemas[name] = &Schema{}
+	*schemas[name] = *g.objectOf(t, nil)
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// bodyOf returns the schema of the request body decoded into the handler's
+// input, leaving out the fields bound from the path and query. It returns nil
+// if there's nothing to decode.
+func (g *generator) bodyOf(t reflect.Type) *Schema {
+	if t.Kind() != reflect.Struct {
+		if t.Kind() == reflect.Pointer || t.Kind() == reflect.Interface {
+			return nil
+		}
+		return g.schemaOf(t)
+	}
+	schema := g.objectOf(t, func(field reflect.StructField) bool {
+		_, path := field.Tag.Lookup("path")
+		_, query := field.Tag.Lookup("query")
+		return !path && !query
+	})
+	if len(schema.Properties) == 0 {
+		return nil
+	}
+	return schema
+}
+
+// objectOf returns the schema of the struct's fields as encoded by
+// encoding/json. Fields are only included if keep returns true.
+func (g *generator) objectOf(t reflect.Type, keep func(reflect.StructField) bool) *Schema {
+	schema := &Schema{Type: Type{"object"}, Properties: map[string]*Schema{}}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if keep != nil && !keep(field) {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			// Fields of embedded structs are promoted
+			if embedded.Kind() == reflect.Struct {
+				promoted := g.objectOf(embedded, keep)
+				for key, property := range promoted.Properties {
+					if _, ok := schema.Properties[key]; !ok {
+						schema.Properties[key] = property
+					}
+				}
+				schema.Required = append(schema.Required, promoted.Required...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = g.schemaOf(field.Type)
+		if hasOption(options, "required") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+// hasOption returns true if the comma-separated tag options contain option
+func hasOption(options, option string) bool {
+	for o := range strings.SplitSeq(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
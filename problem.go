@@ -0,0 +1,121 @@
+package mux
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Problem details an error in an HTTP API response as defined by RFC 9457.
+// Handlers can return a problem as an error or write it as a response.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+var _ error = (*Problem)(nil)
+var _ http.Handler = (*Problem)(nil)
+
+// Error implements error
+func (p *Problem) Error() string {
+	title := p.Title
+	if title == "" {
+		title = http.StatusText(p.status())
+	}
+	if p.Detail == "" {
+		return fmt.Sprintf("%d %s", p.status(), title)
+	}
+	return fmt.Sprintf("%d %s: %s", p.status(), title, p.Detail)
+}
+
+// ServeHTTP writes the problem as application/problem+json. Missing fields are
+// filled in from the status and request.
+func (p *Problem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	problem := *p
+	problem.Status = p.status()
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+	if problem.Instance == "" {
+		problem.Instance = r.URL.Path
+	}
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/problem+json")
+	header.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// status defaults to 500 Internal Server Error
+func (p *Problem) status() int {
+	if p.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return p.Status
+}
+
+// API responds to routing errors with problem details instead of plain text,
+// e.g. router.Group("/api", mux.API())
+func API() Option {
+	return func(rt *Router) {
+		rt.notFound = http.HandlerFunc(problemNotFound)
+		rt.methodNotAllowed = http.HandlerFunc(problemMethodNotAllowed)
+		rt.notAcceptable = http.HandlerFunc(problemNotAcceptable)
+		rt.internalError = problemInternalError
+		rt.errorHandler = problemError
+	}
+}
+
+func problemNotFound(w http.ResponseWriter, r *http.Request) {
+	problem := &Problem{
+		Status: http.StatusNotFound,
+		Detail: fmt.Sprintf("No route matches %s %s", r.Method, r.URL.Path),
+	}
+	problem.ServeHTTP(w, r)
+}
+
+func problemMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	problem := &Problem{
+		Status: http.StatusMethodNotAllowed,
+		Detail: fmt.Sprintf("%s %s is not allowed, use %s", r.Method, r.URL.Path, w.Header().Get("Allow")),
+	}
+	problem.ServeHTTP(w, r)
+}
+
+func problemNotAcceptable(w http.ResponseWriter, r *http.Request) {
+	problem := &Problem{
+		Status: http.StatusNotAcceptable,
+		Detail: fmt.Sprintf("%s %s can't respond with a media type accepted by %q", r.Method, r.URL.Path, r.Header.Get("Accept")),
+	}
+	problem.ServeHTTP(w, r)
+}
+
+// problemInternalError writes routing errors as problems. Like other server
+// errors, they only include the status, since the error is internal.
+func problemInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := &Problem{Status: http.StatusInternalServerError}
+	problem.ServeHTTP(w, r)
+}
+
+// problemError writes errors returned by handlers as problems. Client errors
+// include the error message, while server errors only include the status.
+func problemError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := new(Problem)
+	if errors.As(err, &problem) {
+		problem.ServeHTTP(w, r)
+		return
+	}
+	problem.Status = StatusOf(err)
+	if problem.Status < http.StatusInternalServerError {
+		problem.Detail = err.Error()
+	}
+	problem.ServeHTTP(w, r)
+}
@@ -0,0 +1,317 @@
+package mux
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/matthewmueller/enroute"
+)
+
+// registry holds the routes shared by a router and its groups. Writers take
+// the lock and change a draft table. Requests load the published table without
+// locking. The first request after a change compiles and publishes the draft,
+// which is never written to again.
+type registry struct {
+	mu        sync.Mutex
+	root      *Router   // router that created the registry
+	records   []*record // registered routes in order
+	groups    []*Router // groups with options
+	draft     *table    // table being written to, nil once published
+	published *table    // last published table
+	snapshot  atomic.Pointer[table]
+}
+
+// record of a registered route, used to rebuild the table
+type record struct {
+	method string
+	host   string
+	route  string
+	entry  *entry
+}
+
+// table of routes and their compiled handlers. Tables are immutable once
+// published.
+type table struct {
+	hosts      *hosts
+	names      map[string]*record       // route name => record
+	handler    http.Handler             // router middleware wrapping the routes
+	chains     map[*entry]http.Handler  // handlers wrapped in their group middleware
+	options    map[*Router]http.Handler // automatic OPTIONS responses by group
+	middleware map[*entry][]string      // names of the middleware wrapping handlers
+	groups     []*Router                // groups with options, innermost first
+}
+
+func newRegistry(root *Router) *registry {
+	return &registry{
+		root:      root,
+		published: newTable(),
+	}
+}
+
+func newTable() *table {
+	return &table{
+		hosts: &hosts{
+			tree:    enroute.New(),
+			methods: map[string]map[string]*tree{},
+		},
+		names: map[string]*record{},
+	}
+}
+
+// load the current table, publishing the draft if the routes have changed
+func (r *registry) load() *table {
+	if t := r.snapshot.Load(); t != nil {
+		return t
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t := r.snapshot.Load(); t != nil {
+		return t
+	}
+	t := r.draft
+	if t == nil {
+		// Only the middleware changed, so share the published routes
+		t = &table{hosts: r.published.hosts, names: r.published.names}
+	}
+	t.compile(r.root, r.records, r.groups)
+	r.draft = nil
+	r.published = t
+	r.snapshot.Store(t)
+	return t
+}
+
+// change runs fn under the lock and recompiles the handlers on the next
+// request. It's used to change middleware stacks.
+func (r *registry) change(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn()
+	r.snapshot.Store(nil)
+}
+
+// add a route
+func (r *registry) add(rec *record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.draft == nil {
+		r.draft = r.build(r.records)
+	}
+	if err := r.draft.add(rec); err != nil {
+		// The draft may be partially written, so rebuild it
+		r.draft = r.build(r.records)
+		return err
+	}
+	r.records = append(r.records, rec)
+	r.snapshot.Store(nil)
+	return nil
+}
+
+// addAll adds the records together. If any of them fail, none of them are
+// added.
+func (r *registry) addAll(records []*record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.draft == nil {
+		r.draft = r.build(r.records)
+	}
+	for _, rec := range records {
+		if err := r.draft.add(rec); err != nil {
+			// The draft may be partially written, so rebuild it
+			r.draft = r.build(r.records)
+			return err
+		}
+	}
+	r.records = append(r.records, records...)
+	r.snapshot.Store(nil)
+	return nil
+}
+
+// batch of records that are added together
+type batch struct {
+	registry *registry
+	base     []*record // routes registered when the batch started
+	records  []*record // routes added to the batch
+	draft    *table    // base and batch routes, to check each added route
+}
+
+// batch starts a batch of records
+func (r *registry) batch() *batch {
+	r.mu.Lock()
+	base := slices.Clone(r.records)
+	r.mu.Unlock()
+	return &batch{
+		registry: r,
+		base:     base,
+		draft:    r.build(base),
+	}
+}
+
+// add a record to the batch, if it fits with the routes so far
+func (b *batch) add(rec *record) error {
+	if err := b.draft.add(rec); err != nil {
+		// The draft may be partially written, so rebuild it
+		b.draft = b.registry.build(slices.Concat(b.base, b.records))
+		return err
+	}
+	b.records = append(b.records, rec)
+	return nil
+}
+
+// commit the batch's records to the registry
+func (b *batch) commit() error {
+	return b.registry.addAll(b.records)
+}
+
+// replace the route that has the same method, host, route and conditions as
+// the record, or add it if there's none. The record takes the replaced
+// route's place, since the order routes are inserted in decides between
+// slots in the same place.
+func (r *registry) replace(rec *record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := slices.Clone(r.records)
+	index := slices.IndexFunc(records, func(existing *record) bool {
+		return existing.same(rec.method, rec.host, rec.route) &&
+			existing.entry.conditions() == rec.entry.conditions()
+	})
+	if index < 0 {
+		records = append(records, rec)
+	} else {
+		records[index] = rec
+	}
+	draft := newTable()
+	for _, rec := range records {
+		if err := draft.add(rec); err != nil {
+			return err
+		}
+	}
+	r.records = records
+	r.draft = draft
+	r.snapshot.Store(nil)
+	return nil
+}
+
+// remove every handler registered for the method, host and route
+func (r *registry) remove(method, host, route string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := slices.DeleteFunc(slices.Clone(r.records), func(existing *record) bool {
+		return existing.same(method, host, route)
+	})
+	if len(records) == len(r.records) {
+		return fmt.Errorf("router: %w found for %s %s%s", ErrNoMatch, method, host, route)
+	}
+	r.records = records
+	r.draft = r.build(records)
+	r.snapshot.Store(nil)
+	return nil
+}
+
+// build a table from the records. The records were already added once, so
+// they're expected to add cleanly.
+func (r *registry) build(records []*record) *table {
+	t := newTable()
+	for _, rec := range records {
+		if err := t.add(rec); err != nil {
+			panic(fmt.Sprintf("router: unable to rebuild %s %s%s. %s", rec.method, rec.host, rec.route, err))
+		}
+	}
+	return t
+}
+
+// compile the middleware chains, so they're composed once instead of on every
+// request
+func (t *table) compile(root *Router, records []*record, groups []*Router) {
+	t.chains = make(map[*entry]http.Handler, len(records))
+	t.middleware = make(map[*entry][]string, len(records))
+	t.options = map[*Router]http.Handler{}
+	for _, rec := range records {
+		group := rec.entry.router
+		t.chains[rec.entry] = group.chain(rec.entry.handler)
+		t.middleware[rec.entry] = group.middleware()
+		if _, ok := t.options[group]; !ok {
+			t.options[group] = group.wrap(http.HandlerFunc(noContent))
+		}
+	}
+	// Sort groups so the innermost group containing a path is found first
+	t.groups = slices.Clone(groups)
+	sort.SliceStable(t.groups, func(i, j int) bool {
+		if len(t.groups[i].base) != len(t.groups[j].base) {
+			return len(t.groups[i].base) > len(t.groups[j].base)
+		}
+		return t.groups[i].host != "" && t.groups[j].host == ""
+	})
+	t.handler = root.Middleware(root.notFound)
+}
+
+// group returns the innermost group with options whose routes would contain
+// the host and path, or nil if there's none
+func (t *table) group(host, path string) *Router {
+	if len(t.groups) == 0 {
+		return nil
+	}
+	pattern := ""
+	if scope, ok := t.hosts.scope(host); ok {
+		pattern = scope.host
+	}
+	for _, group := range t.groups {
+		if group.host != "" && group.host != pattern {
+			continue
+		}
+		if within(path, group.base) {
+			return group
+		}
+	}
+	return nil
+}
+
+// within returns true if the path is the base path or below it
+func within(path, base string) bool {
+	if len(path) < len(base) || !strings.EqualFold(path[:len(base)], base) {
+		return false
+	}
+	return len(path) == len(base) || path[len(base)] == '/'
+}
+
+// same returns true if the record is for the method, host and route
+func (rec *record) same(method, host, route string) bool {
+	return rec.method == method && rec.host == host && shape(rec.route) == shape(route)
+}
+
+// add a route to the table
+func (t *table) add(rec *record) error {
+	name := rec.entry.name
+	if name != "" {
+		if existing, ok := t.names[name]; ok && existing.route != rec.route {
+			return fmt.Errorf("router: %w name %q already refers to %q", ErrDuplicate, name, existing.entry.label(existing.route))
+		}
+	}
+	if err := t.hosts.insert(rec.host); err != nil {
+		return err
+	}
+	methods := t.hosts.methods[rec.host]
+	if methods == nil {
+		methods = map[string]*tree{}
+		t.hosts.methods[rec.host] = methods
+	}
+	tr := methods[rec.method]
+	if tr == nil {
+		tr = &tree{
+			Tree:    enroute.New(),
+			Entries: map[string][]*entry{},
+		}
+		methods[rec.method] = tr
+	}
+	if err := tr.Insert(rec.method, rec.route, rec.entry); err != nil {
+		return err
+	}
+	if name != "" {
+		t.names[name] = rec
+	}
+	return nil
+}
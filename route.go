@@ -0,0 +1,240 @@
+package mux
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/matthewmueller/enroute"
+)
+
+// Route builds a route that also matches on the request's query, headers or
+// scheme. Routes built this way can share a method and path with other
+// handlers. The first route whose matchers match the request handles it, with
+// the route registered without matchers acting as the fallback.
+//
+//	router.Route("GET", "/search").Query("q", "{q}").Header("X-Api-Version", "2").Handler(h)
+func (rt *Router) Route(method, route string) *Builder {
+	return &Builder{
+		router: rt,
+		method: method,
+		route:  route,
+		name:   rt.name,
+	}
+}
+
+// Builder for a route with request matchers
+type Builder struct {
+	router   *Router
+	method   string
+	route    string
+	name     string
+	matchers []matcher
+	accept   []string
+	err      error
+}
+
+// Query requires the query parameter to match the value. The value may be a
+// literal, a slot like "{q}" that matches any value, or a regexp slot like
+// "{page|[0-9]+}". Slot values are available just like path slots.
+func (b *Builder) Query(key, value string) *Builder {
+	return b.match("query", key, value, func(r *http.Request) (string, bool) {
+		query := r.URL.Query()
+		return query.Get(key), query.Has(key)
+	})
+}
+
+// Header requires the request header to match the value. The value follows
+// the same rules as Query.
+func (b *Builder) Header(key, value string) *Builder {
+	key = http.CanonicalHeaderKey(key)
+	return b.match("header", key, value, func(r *http.Request) (string, bool) {
+		values, ok := r.Header[key]
+		if !ok || len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	})
+}
+
+// Scheme requires the request to use the scheme (e.g. "https")
+func (b *Builder) Scheme(scheme string) *Builder {
+	b.matchers = append(b.matchers, &schemeMatcher{strings.ToLower(scheme)})
+	return b
+}
+
+// Name the route, so its URL can be built with URL
+func (b *Builder) Name(name string) *Builder {
+	b.name = name
+	return b
+}
+
+// Handler registers the route with the handler
+func (b *Builder) Handler(handler http.Handler) error {
+	if b.err != nil {
+		return b.err
+	}
+	if !isMethod(b.method) {
+		return fmt.Errorf("router: %q is not a valid HTTP method", b.method)
+	}
+	return b.router.add(b.method, b.route, &entry{
+		handler:  handler,
+		router:   b.router,
+		name:     b.name,
+		matchers: b.matchers,
+		accept:   b.accept,
+	})
+}
+
+func (b *Builder) match(kind, key, value string, lookup func(r *http.Request) (string, bool)) *Builder {
+	m, err := parseValueMatcher(kind, key, value, lookup)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return b
+	}
+	b.matchers = append(b.matchers, m)
+	return b
+}
+
+// matcher matches a part of the request that's not the path
+type matcher interface {
+	fmt.Stringer
+	Match(r *http.Request) (slots []*enroute.Slot, ok bool)
+}
+
+// choose the first entry whose matchers match the request and update the match
+// to use it. Entries that accept media types are negotiated as a group. Slots
+// captured by the matchers are added to the match.
+func (m *Match) choose(r *http.Request) error {
+	var fallback *entry
+	var fallbackSlots []*enroute.Slot
+	var negotiable []*entry
+	var negotiableSlots [][]*enroute.Slot
+	for _, entry := range m.entries {
+		slots, ok := matchAll(entry.matchers, r)
+		if !ok {
+			continue
+		}
+		if len(entry.accept) > 0 {
+			negotiable = append(negotiable, entry)
+			negotiableSlots = append(negotiableSlots, slots)
+			continue
+		}
+		if fallback == nil {
+			fallback, fallbackSlots = entry, slots
+		}
+	}
+	chosen, slots := fallback, fallbackSlots
+	if len(negotiable) > 0 {
+		entry, entrySlots, err := m.negotiate(r, negotiable, negotiableSlots)
+		if err == nil {
+			chosen, slots = entry, entrySlots
+		} else if fallback == nil {
+			return err
+		}
+	}
+	if chosen == nil {
+		return fmt.Errorf("router: %w found for %s %s", ErrNoMatch, r.Method, r.URL.Path)
+	}
+	m.Handler = chosen.handler
+	m.router = chosen.router
+	m.entry = chosen
+	m.Slots = append(m.Slots, slots...)
+	return nil
+}
+
+// negotiates returns true if the response depends on the Accept header
+func (m *Match) negotiates() bool {
+	for _, entry := range m.entries {
+		if len(entry.accept) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAll(matchers []matcher, r *http.Request) (slots []*enroute.Slot, ok bool) {
+	for _, m := range matchers {
+		captured, ok := m.Match(r)
+		if !ok {
+			return nil, false
+		}
+		slots = append(slots, captured...)
+	}
+	return slots, true
+}
+
+// valueMatcher matches a query parameter or header value
+type valueMatcher struct {
+	kind    string
+	key     string
+	value   string
+	slot    string         // slot name when the value is a slot
+	pattern *regexp.Regexp // pattern when the slot has a regexp
+	lookup  func(r *http.Request) (string, bool)
+}
+
+func parseValueMatcher(kind, key, value string, lookup func(r *http.Request) (string, bool)) (*valueMatcher, error) {
+	m := &valueMatcher{kind: kind, key: key, value: value, lookup: lookup}
+	if !strings.HasPrefix(value, "{") || !strings.HasSuffix(value, "}") {
+		return m, nil
+	}
+	slot, pattern, hasPattern := strings.Cut(value[1:len(value)-1], "|")
+	if slot == "" {
+		return nil, fmt.Errorf("router: missing slot name in %s %s=%s", kind, key, value)
+	}
+	m.slot = slot
+	if hasPattern {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("router: invalid regexp in %s %s=%s. %w", kind, key, value, err)
+		}
+		m.pattern = re
+	}
+	return m, nil
+}
+
+func (m *valueMatcher) String() string {
+	return m.kind + " " + m.key + "=" + m.value
+}
+
+func (m *valueMatcher) Match(r *http.Request) ([]*enroute.Slot, bool) {
+	value, ok := m.lookup(r)
+	if !ok {
+		return nil, false
+	}
+	if m.slot == "" {
+		return nil, value == m.value
+	}
+	if m.pattern != nil && !m.pattern.MatchString(value) {
+		return nil, false
+	}
+	return []*enroute.Slot{{Key: m.slot, Value: value}}, true
+}
+
+// schemeMatcher matches the request's scheme
+type schemeMatcher struct {
+	scheme string
+}
+
+func (m *schemeMatcher) String() string {
+	return "scheme " + m.scheme
+}
+
+func (m *schemeMatcher) Match(r *http.Request) ([]*enroute.Slot, bool) {
+	return nil, scheme(r) == m.scheme
+}
+
+// scheme returns the request's scheme
+func scheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return strings.ToLower(r.URL.Scheme)
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
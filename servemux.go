@@ -0,0 +1,178 @@
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/livebud/mux/internal/snake"
+)
+
+// handleMethods in the order Handle registers patterns without a method.
+// OPTIONS is left to the router's automatic response, while CONNECT and TRACE
+// are rarely meant to reach a handler.
+var handleMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// Handle registers the handler for a net/http ServeMux pattern, e.g.
+// "GET example.com/users/{id}/{rest...}", so routes can move between
+// http.ServeMux and the router without being rewritten. The pattern's path is
+// relative to the group, like other routes.
+//
+// Patterns translate into routes as follows:
+//
+//   - "{id}" becomes the slot {id}. Wildcard names are converted to snake_case
+//     slots (e.g. {userID} becomes {user_id}), while handlers can still read
+//     them with r.PathValue("userID").
+//   - "{rest...}" becomes the wildcard slot {rest*}.
+//   - A trailing slash (e.g. "/static/") matches every path below it, like the
+//     wildcard slot {rest*}. Handlers can read the rest of the path with
+//     r.PathValue("rest"), so the pattern can't also have a {rest} wildcard.
+//   - "{$}" only matches the path ending in a slash.
+//   - A host (e.g. "example.com/") scopes the route like Host.
+//   - A pattern without a method is registered for GET, HEAD, POST, PUT, PATCH
+//     and DELETE, unless the method already has a handler for the route.
+//     OPTIONS requests get the router's automatic response, so CORS preflights
+//     still work. Register OPTIONS, CONNECT or TRACE with a method to handle
+//     them.
+//
+// Routes are matched by the router's rules rather than ServeMux's:
+//
+//   - Static paths are case-insensitive and trailing slashes are optional, so
+//     "/users/{$}" also matches /users, while "/static/" and
+//     "/files/{path...}" also match /static and /files instead of redirecting.
+//   - Patterns that ServeMux rejects as conflicting, like "/posts/{id}" and
+//     "/{resource}/latest", are both accepted. The route with the longest
+//     static prefix wins, so /posts/latest matches "/posts/{id}".
+//   - Patterns with a method take precedence over patterns without one only
+//     when they're registered first. Registering "GET /users" after "/users"
+//     fails with ErrDuplicate.
+func (rt *Router) Handle(pattern string, handler http.Handler) error {
+	method, host, route, renamed, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+	group := rt
+	if host != "" {
+		group = rt.Host(host)
+	}
+	if len(renamed) > 0 {
+		handler = renameSlots(handler, renamed)
+	}
+	if method != "" {
+		return group.set(method, route, handler)
+	}
+	// Without a method, the pattern matches the common methods. A GET route
+	// registered first also handles HEAD, like it does in ServeMux.
+	var duplicate error
+	registered, hasGet := false, false
+	for _, method := range handleMethods {
+		if method == http.MethodHead && hasGet {
+			continue
+		}
+		err := group.set(method, route, handler)
+		if errors.Is(err, ErrDuplicate) {
+			duplicate = err
+			hasGet = hasGet || method == http.MethodGet
+			continue
+		} else if err != nil {
+			return err
+		}
+		registered = true
+	}
+	if !registered {
+		return duplicate
+	}
+	return nil
+}
+
+// parsePattern translates a ServeMux pattern into a method, host and route
+func parsePattern(pattern string) (method, host, route string, renamed map[string]string, err error) {
+	rest := strings.TrimLeft(pattern, " \t")
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		method, rest = rest[:i], strings.TrimLeft(rest[i:], " \t")
+		if !isMethod(method) {
+			return "", "", "", nil, fmt.Errorf("router: %q is not a valid HTTP method in pattern %q", method, pattern)
+		}
+	}
+	slash := strings.IndexByte(rest, '/')
+	if slash < 0 {
+		return "", "", "", nil, fmt.Errorf("router: pattern %q is missing a path", pattern)
+	}
+	host, rest = rest[:slash], rest[slash:]
+	var b strings.Builder
+	hasRest := false // whether a wildcard is named rest
+	segments := strings.Split(rest[1:], "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if !strings.HasPrefix(segment, "{") {
+			if strings.ContainsAny(segment, "{}") {
+				return "", "", "", nil, fmt.Errorf("router: wildcards in pattern %q must be whole path segments", pattern)
+			}
+			if segment == "" && last {
+				// Trailing slashes match every path below them
+				if hasRest {
+					return "", "", "", nil, fmt.Errorf("router: {rest} in pattern %q is taken by the trailing slash", pattern)
+				}
+				b.WriteString("/{rest*}")
+				continue
+			}
+			b.WriteString("/" + segment)
+			continue
+		}
+		if !strings.HasSuffix(segment, "}") {
+			return "", "", "", nil, fmt.Errorf("router: wildcards in pattern %q must be whole path segments", pattern)
+		}
+		name := segment[1 : len(segment)-1]
+		if name == "$" {
+			if !last {
+				return "", "", "", nil, fmt.Errorf("router: {$} in pattern %q must be at the end", pattern)
+			}
+			// Trailing slashes are optional, so {$} matches the path before it
+			continue
+		}
+		name, wildcard := strings.CutSuffix(name, "...")
+		if wildcard && !last {
+			return "", "", "", nil, fmt.Errorf("router: {%s...} in pattern %q must be at the end", name, pattern)
+		}
+		slot := snake.Case(name)
+		if slot == "" {
+			return "", "", "", nil, fmt.Errorf("router: empty wildcard in pattern %q", pattern)
+		}
+		hasRest = hasRest || slot == "rest"
+		if slot != name {
+			if renamed == nil {
+				renamed = map[string]string{}
+			}
+			renamed[slot] = name
+		}
+		if wildcard {
+			b.WriteString("/{" + slot + "*}")
+			continue
+		}
+		b.WriteString("/{" + slot + "}")
+	}
+	route = b.String()
+	if route == "" {
+		route = "/"
+	}
+	return method, host, route, renamed, nil
+}
+
+// renameSlots sets the wildcard names of the pattern from the renamed slots,
+// so handlers can read them by the names in the pattern
+func renameSlots(handler http.Handler, renamed map[string]string) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		for slot, name := range renamed {
+			r.SetPathValue(name, r.PathValue(slot))
+		}
+		return Serve(w, r, handler)
+	}
+}
@@ -3,20 +3,90 @@ package mux
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/matthewmueller/enroute"
+	"github.com/matthewmueller/enroute/ast"
 )
 
 type tree struct {
-	Tree     *enroute.Tree
-	Handlers map[string]http.Handler
+	Tree    *enroute.Tree
+	Entries map[string][]*entry
+	static  map[string]*Match // routes without slots or matchers by path
 }
 
-func (t *tree) Insert(route string, handler http.Handler) error {
+// entry is a handler stored in the tree
+type entry struct {
+	handler  http.Handler
+	router   *Router // router or group that registered the handler
+	name     string
+	matchers []matcher
+	accept   []string // media types the handler produces
+	source   string   // file:line where the route was registered
+	pattern  string   // route as registered if it has constrained slots, e.g. /users/{id:int}
+}
+
+// label returns the route to show for the entry, keeping the constrained
+// slots the route was registered with instead of their regexp slots
+func (e *entry) label(route string) string {
+	if e.pattern != "" {
+		return e.pattern
+	}
+	return route
+}
+
+// conditions returns a key describing the entry's matchers
+func (e *entry) conditions() string {
+	return strings.Join(e.describe(), " ")
+}
+
+// describe the entry's matchers
+func (e *entry) describe() (matchers []string) {
+	for _, m := range e.matchers {
+		matchers = append(matchers, m.String())
+	}
+	if len(e.accept) > 0 {
+		matchers = append(matchers, "accept "+strings.Join(e.accept, ", "))
+	}
+	return matchers
+}
+
+func (t *tree) Insert(method, route string, e *entry) error {
+	// Share the route with handlers that match on other parts of the request
+	if node, err := t.Tree.Find(route); err == nil && node.Label == label(route) {
+		entries := t.Entries[node.Value]
+		for _, existing := range entries {
+			if existing.conditions() == e.conditions() {
+				return fmt.Errorf("%w already exists %q", ErrDuplicate, node.Label)
+			}
+		}
+		t.Entries[node.Value] = sortEntries(append(entries, e))
+		// The handler needs to be chosen per request now
+		delete(t.static, node.Label)
+		return nil
+	}
 	if err := t.Tree.Insert(route, route); err != nil {
 		return err
 	}
-	t.Handlers[route] = handler
+	entries := []*entry{e}
+	t.Entries[route] = entries
+	// Match routes without slots or matchers by path before searching the tree
+	if path := label(route); !strings.Contains(path, "{") && e.conditions() == "" {
+		if t.static == nil {
+			t.static = map[string]*Match{}
+		}
+		t.static[path] = &Match{
+			Method:  method,
+			Route:   path,
+			Path:    path,
+			Handler: e.handler,
+			router:  e.router,
+			entry:   e,
+			entries: entries,
+			pattern: method + " " + path,
+			static:  true,
+		}
+	}
 	return nil
 }
 
@@ -25,32 +95,50 @@ func (t *tree) Find(method, route string) (*Route, error) {
 	if err != nil {
 		return nil, err
 	}
-	handler, ok := t.Handlers[route]
+	entries, ok := t.Entries[node.Value]
 	if !ok {
 		return nil, fmt.Errorf("router: handler not found for %s %s", method, route)
 	}
+	entry := entries[len(entries)-1]
 	return &Route{
-		Method:  method,
-		Route:   node.Label,
-		Handler: handler,
+		Method:   method,
+		Route:    entry.label(node.Label),
+		Name:     entry.name,
+		Matchers: entry.describe(),
+		Handler:  entry.handler,
+		Source:   entry.source,
+		route:    node.Label,
+		entry:    entry,
 	}, nil
 }
 
+// Match the path. Static matches are shared between requests, so they
+// shouldn't be modified by callers outside the package.
 func (t *tree) Match(method, path string) (*Match, error) {
+	if match, ok := t.static[path]; ok {
+		return match, nil
+	}
 	m, err := t.Tree.Match(path)
 	if err != nil {
 		return nil, err
 	}
-	handler, ok := t.Handlers[m.Value]
+	entries, ok := t.Entries[m.Value]
 	if !ok {
 		return nil, fmt.Errorf("router: no handler provided for %s %s", method, path)
 	}
+	// Default to the last entry, which is the one without matchers if present
+	entry := entries[len(entries)-1]
+	route := entry.label(m.Route)
 	return &Match{
 		Method:  method,
-		Route:   m.Route,
+		Route:   route,
 		Path:    m.Path,
 		Slots:   m.Slots,
-		Handler: handler,
+		Handler: entry.handler,
+		router:  entry.router,
+		entry:   entry,
+		entries: entries,
+		pattern: method + " " + route,
 	}, nil
 }
 
@@ -59,16 +147,84 @@ func (t *tree) Routes(method string) (routes []*Route) {
 		if node.Label == "" {
 			return true
 		}
-		handler, ok := t.Handlers[node.Value]
+		entries, ok := t.Entries[node.Value]
 		if !ok {
 			return true
 		}
-		routes = append(routes, &Route{
-			Method:  method,
-			Route:   node.Label,
-			Handler: handler,
-		})
+		for _, entry := range entries {
+			routes = append(routes, &Route{
+				Method:   method,
+				Route:    entry.label(node.Label),
+				Name:     entry.name,
+				Matchers: entry.describe(),
+				Handler:  entry.handler,
+				Source:   entry.source,
+				route:    node.Label,
+				entry:    entry,
+			})
+		}
 		return true
 	})
 	return routes
 }
+
+// sortEntries moves the entry without matchers to the end, so it's only used
+// when no other entry matches the request
+func sortEntries(entries []*entry) []*entry {
+	for i, entry := range entries {
+		if entry.conditions() == "" && i != len(entries)-1 {
+			entries = append(append(entries[:i:i], entries[i+1:]...), entry)
+			break
+		}
+	}
+	return entries
+}
+
+// label returns the route as it's labeled in the tree
+func label(route string) string {
+	r, err := enroute.Parse(trimTrailingSlash(route))
+	if err != nil {
+		return ""
+	}
+	return r.String()
+}
+
+// shape returns the route's label without slot names, so routes that only
+// differ by slot names (e.g. /users/{id} and /users/{user_id}) are the same
+func shape(route string) string {
+	r, err := enroute.Parse(trimTrailingSlash(route))
+	if err != nil {
+		return ""
+	}
+	return shapeOf(r.Sections)
+}
+
+// shapeOf returns the sections without slot names, which is how the tree
+// compares them
+func shapeOf(sections ast.Sections) string {
+	var b strings.Builder
+	for _, section := range sections {
+		switch s := section.(type) {
+		case *ast.RequiredSlot:
+			b.WriteString("{}")
+		case *ast.OptionalSlot:
+			b.WriteString("{?}")
+		case *ast.WildcardSlot:
+			b.WriteString("{*}")
+		case *ast.RegexpSlot:
+			b.WriteString("{|" + s.Pattern.String() + "}")
+		default:
+			b.WriteString(s.String())
+		}
+	}
+	return b.String()
+}
+
+// trimTrailingSlash strips any trailing slash (e.g. /users/ => /users)
+func trimTrailingSlash(route string) string {
+	route = strings.TrimRight(route, "/")
+	if route == "" {
+		return "/"
+	}
+	return route
+}
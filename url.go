@@ -0,0 +1,129 @@
+package mux
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/matthewmueller/enroute"
+	"github.com/matthewmueller/enroute/ast"
+)
+
+// MissingSlotError is returned when building a URL without a value for a
+// required slot
+type MissingSlotError struct {
+	Route string
+	Slot  string
+}
+
+func (e *MissingSlotError) Error() string {
+	return fmt.Sprintf("router: missing slot %q for %s", e.Slot, e.Route)
+}
+
+// InvalidSlotError is returned when building a URL with a value that doesn't
+// match the slot's regular expression
+type InvalidSlotError struct {
+	Route   string
+	Slot    string
+	Value   string
+	Pattern string
+}
+
+func (e *InvalidSlotError) Error() string {
+	return fmt.Sprintf("router: slot %q value %q doesn't match %q for %s", e.Slot, e.Value, e.Pattern, e.Route)
+}
+
+// URL builds the path for a named route from key-value pairs, for example:
+//
+//	router.URL("user.show", "id", "10")
+func (rt *Router) URL(name string, pairs ...string) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("router: odd number of slot pairs for route named %q", name)
+	}
+	slots := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		slots[pairs[i]] = pairs[i+1]
+	}
+	return rt.Build(name, slots)
+}
+
+// Build the path for a named route from a map of slot values. Optional and
+// wildcard slots may be left out.
+func (rt *Router) Build(name string, slots map[string]string) (string, error) {
+	rec, ok := rt.registry.load().names[name]
+	if !ok {
+		return "", fmt.Errorf("router: %w found for route named %q", ErrNoMatch, name)
+	}
+	return build(rec.route, rec.entry.label(rec.route), slots)
+}
+
+// build a path from the route and slot values. Errors refer to the route by
+// its label.
+func build(route, label string, slots map[string]string) (string, error) {
+	r, err := enroute.Parse(route)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, section := range r.Sections {
+		switch s := section.(type) {
+		case *ast.Slash, *ast.Path:
+			parts = append(parts, s.String())
+		case *ast.RequiredSlot:
+			value, ok := slots[s.Key]
+			if !ok || value == "" {
+				return "", &MissingSlotError{label, s.Key}
+			}
+			parts = append(parts, url.PathEscape(value))
+		case *ast.RegexpSlot:
+			value, ok := slots[s.Key]
+			if !ok || value == "" {
+				return "", &MissingSlotError{label, s.Key}
+			}
+			if !s.Pattern.MatchString(value) {
+				return "", &InvalidSlotError{label, s.Key, value, s.Pattern.String()}
+			}
+			parts = append(parts, url.PathEscape(value))
+		case *ast.OptionalSlot:
+			value, ok := slots[s.Key]
+			if !ok || value == "" {
+				parts = trimDelimiter(parts)
+				continue
+			}
+			parts = append(parts, url.PathEscape(value))
+		case *ast.WildcardSlot:
+			value, ok := slots[s.Key]
+			if !ok || value == "" {
+				parts = trimDelimiter(parts)
+				continue
+			}
+			segments := strings.Split(strings.TrimPrefix(value, "/"), "/")
+			for i, segment := range segments {
+				segments[i] = url.PathEscape(segment)
+			}
+			parts = append(parts, strings.Join(segments, "/"))
+		}
+	}
+	path := strings.Join(parts, "")
+	if path == "" {
+		return "/", nil
+	}
+	return path, nil
+}
+
+// trimDelimiter removes the slash or single-character delimiter that came
+// before a slot that was left out (e.g. the "." in "{id}.{format?}")
+func trimDelimiter(parts []string) []string {
+	if len(parts) == 0 {
+		return parts
+	}
+	last := parts[len(parts)-1]
+	if len(last) == 1 && !isAlphanumeric(last[0]) {
+		return parts[:len(parts)-1]
+	}
+	return parts
+}
+
+func isAlphanumeric(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}